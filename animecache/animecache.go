@@ -0,0 +1,381 @@
+package animecache
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"smOwd/animes"
+	"smOwd/logs"
+	"smOwd/pql"
+
+	"github.com/lib/pq"
+)
+
+const tableName = "anime_cache"
+
+// DefaultTTL is how long a cached anime is served without revalidating.
+const DefaultTTL = time.Hour
+
+// revalidateTimeout bounds a background refresh of stale entries.
+const revalidateTimeout = 30 * time.Second
+
+// details holds the Anime fields without a column of their own.
+type details struct {
+	Name       string                 `json:"name,omitempty"`
+	Synonyms   []string               `json:"synonyms,omitempty"`
+	AiredOn    *animes.IncompleteDate `json:"airedOn,omitempty"`
+	ReleasedOn *animes.IncompleteDate `json:"releasedOn,omitempty"`
+	Kind       string                 `json:"kind,omitempty"`
+	Score      float64                `json:"score,omitempty"`
+	Poster     *animes.Poster         `json:"poster,omitempty"`
+	Genres     []animes.Genre         `json:"genres,omitempty"`
+	Studios    []animes.Studio        `json:"studios,omitempty"`
+}
+
+type Entry struct {
+	Anime     animes.Anime
+	FetchedAt time.Time
+}
+
+func CheckTable(ctx context.Context, db *sql.DB) (bool, error) {
+	return pql.CheckTable(ctx, db, tableName)
+}
+
+func CreateTable(ctx context.Context, db *sql.DB) error {
+	columns := `
+		shiki_id TEXT PRIMARY KEY,
+		mal_id TEXT,
+		english TEXT,
+		russian TEXT,
+		japanese TEXT,
+		status TEXT,
+		episodes INT NOT NULL DEFAULT 0,
+		episodes_aired INT NOT NULL DEFAULT 0,
+		url TEXT,
+		next_episode_at TIMESTAMPTZ,
+		details JSONB,
+		fetched_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+	`
+	return pql.CreateTable(ctx, db, tableName, columns,
+		"idx_anime_cache_fetched_at", "fetched_at")
+}
+
+// Migrate adds the columns introduced after the table was first created.
+func Migrate(ctx context.Context, db *sql.DB) error {
+	logger := logs.DefaultFromCtx(ctx)
+
+	_, err := db.ExecContext(ctx, `
+		ALTER TABLE anime_cache
+			ADD COLUMN IF NOT EXISTS next_episode_at TIMESTAMPTZ,
+			ADD COLUMN IF NOT EXISTS details JSONB;
+	`)
+
+	if err != nil {
+		logger.Error("Failed to migrate anime cache table", "error", err)
+	}
+
+	return err
+}
+
+// Put stores freshly fetched animes, replacing older copies.
+func Put(ctx context.Context, db *sql.DB, sliceAnime []animes.Anime) error {
+	logger := logs.DefaultFromCtx(ctx)
+
+	query := `
+		INSERT INTO anime_cache (shiki_id, mal_id, english, russian, japanese,
+			status, episodes, episodes_aired, url, next_episode_at, details,
+			fetched_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, NOW())
+		ON CONFLICT (shiki_id) DO UPDATE SET
+			mal_id = EXCLUDED.mal_id,
+			english = EXCLUDED.english,
+			russian = EXCLUDED.russian,
+			japanese = EXCLUDED.japanese,
+			status = EXCLUDED.status,
+			episodes = EXCLUDED.episodes,
+			episodes_aired = EXCLUDED.episodes_aired,
+			url = EXCLUDED.url,
+			next_episode_at = EXCLUDED.next_episode_at,
+			details = EXCLUDED.details,
+			fetched_at = EXCLUDED.fetched_at
+	`
+
+	for _, a := range sliceAnime {
+		detailsJson, err := json.Marshal(details{
+			Name:       a.Name,
+			Synonyms:   a.Synonyms,
+			AiredOn:    a.AiredOn,
+			ReleasedOn: a.ReleasedOn,
+			Kind:       a.Kind,
+			Score:      a.Score,
+			Poster:     a.Poster,
+			Genres:     a.Genres,
+			Studios:    a.Studios,
+		})
+
+		if err != nil {
+			logger.Error("Failed to marshall anime details", "error", err)
+			return err
+		}
+
+		_, err = db.ExecContext(ctx, query, a.ShikiID, a.MalID, a.English,
+			a.Russian, a.Japanese, a.Status, a.Episodes, a.EpisodesAired, a.URL,
+			a.NextEpisodeAt, string(detailsJson))
+
+		if err != nil {
+			logger.Error("Failed to cache anime",
+				"Shiki ID", a.ShikiID,
+				"error", err)
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Get returns the cached entries for the given ids, in no particular order.
+func Get(ctx context.Context, db *sql.DB, shikiIDs []string) ([]Entry, error) {
+	logger := logs.DefaultFromCtx(ctx)
+
+	query := `
+		SELECT shiki_id, mal_id, english, russian, japanese, status,
+			episodes, episodes_aired, url, next_episode_at, details, fetched_at
+		FROM anime_cache
+		WHERE shiki_id = ANY($1);
+	`
+
+	rows, err := db.QueryContext(ctx, query, pq.Array(shikiIDs))
+
+	if err != nil {
+		logger.Error("Error reading anime cache", "error", err)
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var entries []Entry
+
+	for rows.Next() {
+		var e Entry
+		var malID, english, russian, japanese, status, url sql.NullString
+		var nextEpisodeAt sql.NullTime
+		var detailsJson []byte
+
+		err := rows.Scan(
+			&e.Anime.ShikiID,
+			&malID,
+			&english,
+			&russian,
+			&japanese,
+			&status,
+			&e.Anime.Episodes,
+			&e.Anime.EpisodesAired,
+			&url,
+			&nextEpisodeAt,
+			&detailsJson,
+			&e.FetchedAt,
+		)
+
+		if err != nil {
+			logger.Error("Error processing row", "error", err)
+			return nil, err
+		}
+
+		e.Anime.MalID = malID.String
+		e.Anime.English = english.String
+		e.Anime.Russian = russian.String
+		e.Anime.Japanese = japanese.String
+		e.Anime.Status = status.String
+		e.Anime.URL = url.String
+
+		if nextEpisodeAt.Valid {
+			e.Anime.NextEpisodeAt = &nextEpisodeAt.Time
+		}
+
+		if len(detailsJson) > 0 {
+			var d details
+
+			if err := json.Unmarshal(detailsJson, &d); err != nil {
+				logger.Warn("Failed to unmarshall cached anime details",
+					"Shiki ID", e.Anime.ShikiID,
+					"error", err)
+			} else {
+				e.Anime.Name = d.Name
+				e.Anime.Synonyms = d.Synonyms
+				e.Anime.AiredOn = d.AiredOn
+				e.Anime.ReleasedOn = d.ReleasedOn
+				e.Anime.Kind = d.Kind
+				e.Anime.Score = d.Score
+				e.Anime.Poster = d.Poster
+				e.Anime.Genres = d.Genres
+				e.Anime.Studios = d.Studios
+			}
+		}
+
+		entries = append(entries, e)
+	}
+
+	return entries, rows.Err()
+}
+
+// Source is an animes.AnimeSource that answers id lookups from the cache.
+// Entries older than the TTL are still served, and refreshed from the
+// upstream source in the background (stale-while-revalidate), so listings
+// keep working while the upstream catalog is down.
+type Source struct {
+	db       *sql.DB
+	upstream animes.AnimeSource
+	ttl      time.Duration
+
+	mu         sync.Mutex
+	refreshing map[string]bool
+}
+
+func New(db *sql.DB, upstream animes.AnimeSource, ttl time.Duration) *Source {
+	return &Source{
+		db:         db,
+		upstream:   upstream,
+		ttl:        ttl,
+		refreshing: make(map[string]bool),
+	}
+}
+
+// SearchAnimeByName always asks upstream, then caches what it found.
+func (s *Source) SearchAnimeByName(ctx context.Context, name string,
+	opts animes.SearchOptions) ([]animes.Anime, error) {
+	sliceAnime, err := s.upstream.SearchAnimeByName(ctx, name, opts)
+
+	if err != nil {
+		return nil, err
+	}
+
+	Put(ctx, s.db, sliceAnime)
+
+	return sliceAnime, nil
+}
+
+// SearchAnimeByShikiIDs returns the animes in the order of shikiIDs. Only
+// ids missing from the cache are fetched synchronously; if that fails the
+// cached part is still returned as long as there is one.
+func (s *Source) SearchAnimeByShikiIDs(ctx context.Context,
+	shikiIDs []string) ([]animes.Anime, error) {
+	logger := logs.DefaultFromCtx(ctx)
+
+	entries, err := Get(ctx, s.db, shikiIDs)
+
+	if err != nil {
+		return s.upstream.SearchAnimeByShikiIDs(ctx, shikiIDs)
+	}
+
+	found := make(map[string]animes.Anime, len(entries))
+	var missing, stale []string
+
+	for _, e := range entries {
+		found[e.Anime.ShikiID] = e.Anime
+
+		if time.Since(e.FetchedAt) > s.ttl {
+			stale = append(stale, e.Anime.ShikiID)
+		}
+	}
+
+	for _, id := range shikiIDs {
+		if _, ok := found[id]; !ok {
+			missing = append(missing, id)
+		}
+	}
+
+	if len(missing) > 0 {
+		fetched, err := s.upstream.SearchAnimeByShikiIDs(ctx, missing)
+
+		if err != nil {
+			if len(found) == 0 {
+				return nil, err
+			}
+
+			logger.Warn("Serving partial results from anime cache",
+				"missing", len(missing),
+				"error", err)
+		} else {
+			Put(ctx, s.db, fetched)
+
+			for _, a := range fetched {
+				found[a.ShikiID] = a
+			}
+		}
+	}
+
+	if len(stale) > 0 {
+		s.revalidate(ctx, stale)
+	}
+
+	var result []animes.Anime
+
+	for _, id := range shikiIDs {
+		if a, ok := found[id]; ok {
+			result = append(result, a)
+		}
+	}
+
+	return result, nil
+}
+
+func (s *Source) GetAnimeDetails(ctx context.Context,
+	shikiID string) (*animes.Anime, error) {
+	sliceAnime, err := s.SearchAnimeByShikiIDs(ctx, []string{shikiID})
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(sliceAnime) == 0 {
+		return nil, animes.ErrAnimeNotFound
+	}
+
+	return &sliceAnime[0], nil
+}
+
+// revalidate refreshes stale ids in the background, skipping ids another
+// refresh is already fetching.
+func (s *Source) revalidate(ctx context.Context, shikiIDs []string) {
+	s.mu.Lock()
+	var ids []string
+	for _, id := range shikiIDs {
+		if !s.refreshing[id] {
+			s.refreshing[id] = true
+			ids = append(ids, id)
+		}
+	}
+	s.mu.Unlock()
+
+	if len(ids) == 0 {
+		return
+	}
+
+	go func() {
+		defer func() {
+			s.mu.Lock()
+			for _, id := range ids {
+				delete(s.refreshing, id)
+			}
+			s.mu.Unlock()
+		}()
+
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx),
+			revalidateTimeout)
+		defer cancel()
+
+		logger := logs.DefaultFromCtx(ctx)
+
+		fetched, err := s.upstream.SearchAnimeByShikiIDs(ctx, ids)
+
+		if err != nil {
+			logger.Warn("Failed to revalidate anime cache", "error", err)
+			return
+		}
+
+		Put(ctx, s.db, fetched)
+	}()
+}
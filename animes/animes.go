@@ -4,105 +4,149 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"smOwd/logs"
-	"unicode"
 
 	"strings"
 	"time"
 )
 
-const url = "https://shikimori.one/api/graphql"
+// DefaultURL is the public Shikimori GraphQL endpoint.
+const DefaultURL = "https://shikimori.one/api/graphql"
+
+// maxPageLimit is the largest limit the animes query accepts, and the number
+// of results requested when none is given.
+const maxPageLimit = 50
+
+// animeFields is the selection set requested for every anime.
+const animeFields = `
+			id
+			malId
+			name
+			synonyms
+			english
+			russian
+			japanese
+			status
+			episodes
+			episodesAired
+			url
+			nextEpisodeAt
+			airedOn { year month day date }
+			releasedOn { year month day date }
+			kind
+			score
+			poster { originalUrl mainUrl }
+			genres { id name russian kind }
+			studios { id name }`
 
 type GraphQLRequest struct {
 	Query     string                 `json:"query"`
 	Variables map[string]interface{} `json:"variables"`
 }
 
-var client = &http.Client{Timeout: 10 * time.Second}
+// client is shared by every Shikimori source so they draw on one rate limit.
+var client = NewRateLimitedClient(&http.Client{Timeout: 10 * time.Second})
 
-type Anime struct {
-	ShikiID       string `json:"id"`
-	MalID         string `json:"malId"`
-	English       string `json:"english"`
-	Russian       string `json:"russian"`
-	Japanese      string `json:"japanese"`
-	Status        string `json:"status"`
-	Episodes      int    `json:"episodes"`
-	EpisodesAired int    `json:"episodesAired"`
-	URL           string `json:"url"`
+var ErrAnimeNotFound = errors.New("anime not found")
+
+// AnimeSource is an anime catalog the bot searches and tracks episodes in.
+type AnimeSource interface {
+	SearchAnimeByName(ctx context.Context, name string, opts SearchOptions) ([]Anime, error)
+	SearchAnimeByShikiIDs(ctx context.Context, shikiIDs []string) ([]Anime, error)
+	GetAnimeDetails(ctx context.Context, shikiID string) (*Anime, error)
 }
 
-type AnimeResponse struct {
-	Data struct {
-		Animes []Anime `json:"animes"`
-	} `json:"data"`
-	Errors []struct {
-		Message string `json: "message"`
-	} `json:"errors"`
-}
-
-func splitWords(input string) []string {
-	// Replace underscores with spaces and then split by spaces
-	input = strings.ReplaceAll(input, "_", " ")
-	words := strings.Fields(input)
-	return words
-}
-
-func isWholeWord(word, sentence string) bool {
-	sentenceRunes := []rune(sentence)
-	wordRunes := []rune(word)
-	wordLen := len(wordRunes)
-
-	for i := 0; i <= len(sentenceRunes)-wordLen; i++ {
-		// Check if the substring matches the word
-		if string(sentenceRunes[i:i+wordLen]) == word {
-			// Ensure it's a whole word by checking surrounding characters
-			isStartBoundary := i == 0 || !unicode.IsLetter(sentenceRunes[i-1])
-			isEndBoundary := i+wordLen == len(sentenceRunes) || !unicode.IsLetter(sentenceRunes[i+wordLen])
-			if isStartBoundary && isEndBoundary {
-				return true
-			}
-		}
+// SearchOptions narrows a search by name. Zero values mean defaults:
+// the first page of maxPageLimit results with no kind or status filter.
+// Limits above maxPageLimit are lowered to it.
+type SearchOptions struct {
+	Page   int
+	Limit  int
+	Kind   string // e.g. "tv", "movie", "ova"
+	Status string // e.g. "ongoing", "anons", "released"
+}
+
+// Shikimori is an AnimeSource backed by the Shikimori GraphQL API.
+type Shikimori struct {
+	url    string
+	client *RateLimitedClient
+}
+
+// NewShikimori returns a source querying the GraphQL endpoint at url,
+// or DefaultURL when url is empty.
+func NewShikimori(url string) *Shikimori {
+	if url == "" {
+		url = DefaultURL
 	}
-	return false
+
+	return &Shikimori{url: url, client: client}
 }
 
-// containsAllWords checks if all words in the input exist as whole words in the sentence
-func containsAllWords(input, sentence string) bool {
-	words := splitWords(input)
+// IncompleteDate is a date Shikimori may only know the year or month of.
+type IncompleteDate struct {
+	Year  int    `json:"year"`
+	Month int    `json:"month"`
+	Day   int    `json:"day"`
+	Date  string `json:"date"`
+}
 
-	// Normalize case for case-insensitive matching
-	sentence = strings.ToLower(sentence)
+type Poster struct {
+	OriginalURL string `json:"originalUrl"`
+	MainURL     string `json:"mainUrl"`
+}
 
-	for _, word := range words {
-		if !isWholeWord(strings.ToLower(word), sentence) {
-			return false
-		}
-	}
-	return true
+type Genre struct {
+	ID      string `json:"id"`
+	Name    string `json:"name"`
+	Russian string `json:"russian"`
+	Kind    string `json:"kind"`
 }
 
-func SearchAnimeByName(ctx context.Context, name string) ([]Anime, error) {
-	logger := logs.DefaultFromCtx(ctx)
+type Studio struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
 
-	query := fmt.Sprintf(` query{
-		animes(search: "%s", limit: 500) {
-			id       
-			malId    
-			english 
-			russian  
-			japanese 
-			status
-			episodes 
-			episodesAired
-			url
-		}
-	}`, name)
+type Anime struct {
+	ShikiID       string          `json:"id"`
+	MalID         string          `json:"malId"`
+	Name          string          `json:"name"` // romaji
+	Synonyms      []string        `json:"synonyms"`
+	English       string          `json:"english"`
+	Russian       string          `json:"russian"`
+	Japanese      string          `json:"japanese"`
+	Status        string          `json:"status"`
+	Episodes      int             `json:"episodes"`
+	EpisodesAired int             `json:"episodesAired"`
+	URL           string          `json:"url"`
+	NextEpisodeAt *time.Time      `json:"nextEpisodeAt"`
+	AiredOn       *IncompleteDate `json:"airedOn"`
+	ReleasedOn    *IncompleteDate `json:"releasedOn"`
+	Kind          string          `json:"kind"`
+	Score         float64         `json:"score"`
+	Poster        *Poster         `json:"poster"`
+	Genres        []Genre         `json:"genres"`
+	Studios       []Studio        `json:"studios"`
+}
+
+type ResponseError struct {
+	Message string `json:"message"`
+}
+
+type AnimeResponse struct {
+	Data struct {
+		Animes []Anime `json:"animes"`
+	} `json:"data"`
+	Errors []ResponseError `json:"errors,omitempty"`
+}
 
-	reqBody := GraphQLRequest{Query: query}
+func (s *Shikimori) query(ctx context.Context,
+	reqBody GraphQLRequest) (*AnimeResponse, error) {
+	logger := logs.DefaultFromCtx(ctx)
 
 	reqBodyJson, err := json.Marshal(reqBody)
 
@@ -111,26 +155,36 @@ func SearchAnimeByName(ctx context.Context, name string) ([]Anime, error) {
 		return nil, err
 	}
 
-	req, err := http.NewRequestWithContext(ctx, "POST", url,
+	req, err := http.NewRequestWithContext(ctx, "POST", s.url,
 		bytes.NewBuffer(reqBodyJson))
 
-	req.Header.Set("Content-Type", "application/json")
-
 	if err != nil {
-		logger.Fatal("Failed to create requet", "error", err)
+		logger.Error("Failed to create request", "error", err)
+		return nil, err
 	}
 
-	resp, err := client.Do(req)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "smOwd")
+
+	resp, err := s.client.Do(req)
 
 	if err != nil {
-		logger.Fatal("Failed request", "error", err)
+		logger.Error("Failed request", "error", err)
+		return nil, &NetworkError{Err: err}
 	}
 	defer resp.Body.Close()
 
 	respBody, err := ioutil.ReadAll(resp.Body)
 
 	if err != nil {
-		logger.Fatal("Failed to read response", "error", err)
+		logger.Error("Failed to read response", "error", err)
+		return nil, &NetworkError{Err: err}
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		logger.Error("Unexpected response status", "status", resp.StatusCode)
+		return nil, &StatusError{StatusCode: resp.StatusCode,
+			Body: string(respBody)}
 	}
 
 	var animeResponse AnimeResponse
@@ -138,95 +192,123 @@ func SearchAnimeByName(ctx context.Context, name string) ([]Anime, error) {
 	err = json.Unmarshal(respBody, &animeResponse)
 
 	if err != nil {
-		logger.Fatal("Failed to unmarshall", "error", err)
+		logger.Error("Failed to unmarshall", "error", err)
+		return nil, &DecodeError{Err: err}
 	}
 
 	if len(animeResponse.Errors) > 0 {
+		graphQLError := &GraphQLError{}
+
 		for _, Error := range animeResponse.Errors {
 			logger.Error("GraphQL error", "message", Error.Message)
+			graphQLError.Messages = append(graphQLError.Messages, Error.Message)
 		}
+
+		return nil, graphQLError
 	}
 
-	var result []Anime
+	return &animeResponse, nil
+}
 
-	for _, a := range animeResponse.Data.Animes {
-		if containsAllWords(name, a.English) {
-			result = append(result, a)
-		} else if containsAllWords(name, a.Russian) {
-			result = append(result, a)
+func (s *Shikimori) SearchAnimeByName(ctx context.Context, name string,
+	opts SearchOptions) ([]Anime, error) {
+	query := fmt.Sprintf(` query($search: String!, $limit: PositiveInt,
+		$page: PositiveInt, $kind: AnimeKindString, $status: AnimeStatusString) {
+		animes(search: $search, limit: $limit, page: $page,
+			kind: $kind, status: $status) {%s
 		}
+	}`, animeFields)
+
+	if opts.Page <= 0 {
+		opts.Page = 1
 	}
 
-	return result, nil
-}
+	if opts.Limit <= 0 || opts.Limit > maxPageLimit {
+		opts.Limit = maxPageLimit
+	}
 
-func SearchAnimeByShikiIDs(ctx context.Context, shikiIDs []string) ([]Anime, error) {
-	logger := logs.DefaultFromCtx(ctx)
+	variables := map[string]interface{}{
+		"search": name,
+		"limit":  opts.Limit,
+		"page":   opts.Page,
+	}
 
-	idsString := strings.Join(shikiIDs, ",")
+	if opts.Kind != "" {
+		variables["kind"] = opts.Kind
+	}
 
-	query := fmt.Sprintf(` query($ids: String!) {
-		animes(ids: $ids, limit: %d) {
-			id       
-			malId    
-			english
-			russian   
-			japanese 
-			status
-			episodes 
-			episodesAired
-			url
-		}
-	}`, len(shikiIDs))
+	if opts.Status != "" {
+		variables["status"] = opts.Status
+	}
 
 	reqBody := GraphQLRequest{
-		Query: query,
-		Variables: map[string]interface{}{
-			"ids": idsString,
-		}}
+		Query:     query,
+		Variables: variables,
+	}
 
-	reqBodyJson, err := json.Marshal(reqBody)
+	animeResponse, err := s.query(ctx, reqBody)
 
 	if err != nil {
-		logger.Error("Failed to marshall query", "error", err)
 		return nil, err
 	}
 
-	req, err := http.NewRequestWithContext(ctx, "POST", url,
-		bytes.NewBuffer(reqBodyJson))
+	return RankByRelevance(name, animeResponse.Data.Animes), nil
+}
 
-	req.Header.Set("Content-Type", "application/json")
+// SearchAnimeByShikiIDs looks the ids up in chunks of at most maxPageLimit,
+// the largest page the API serves.
+func (s *Shikimori) SearchAnimeByShikiIDs(ctx context.Context, shikiIDs []string) ([]Anime, error) {
+	var result []Anime
 
-	if err != nil {
-		logger.Fatal("Failed to create requet", "error", err)
-	}
+	for start := 0; start < len(shikiIDs); start += maxPageLimit {
+		end := min(start+maxPageLimit, len(shikiIDs))
 
-	resp, err := client.Do(req)
+		chunk, err := s.searchAnimeByShikiIDsPage(ctx, shikiIDs[start:end])
 
-	if err != nil {
-		logger.Fatal("Failed request", "error", err)
+		if err != nil {
+			return nil, err
+		}
+
+		result = append(result, chunk...)
 	}
-	defer resp.Body.Close()
 
-	respBody, err := ioutil.ReadAll(resp.Body)
+	return result, nil
+}
+
+func (s *Shikimori) searchAnimeByShikiIDsPage(ctx context.Context,
+	shikiIDs []string) ([]Anime, error) {
+	idsString := strings.Join(shikiIDs, ",")
+
+	query := fmt.Sprintf(` query($ids: String!) {
+		animes(ids: $ids, limit: %d) {%s
+		}
+	}`, len(shikiIDs), animeFields)
+
+	reqBody := GraphQLRequest{
+		Query: query,
+		Variables: map[string]interface{}{
+			"ids": idsString,
+		}}
+
+	animeResponse, err := s.query(ctx, reqBody)
 
 	if err != nil {
-		logger.Fatal("Failed to read response", "error", err)
+		return nil, err
 	}
 
-	var animeResponse AnimeResponse
+	return animeResponse.Data.Animes, nil
+}
 
-	err = json.Unmarshal(respBody, &animeResponse)
+func (s *Shikimori) GetAnimeDetails(ctx context.Context, shikiID string) (*Anime, error) {
+	sliceAnime, err := s.SearchAnimeByShikiIDs(ctx, []string{shikiID})
 
 	if err != nil {
-		logger.Fatal("Failed to unmarshall", "error", err)
+		return nil, err
 	}
 
-	if len(animeResponse.Errors) > 0 {
-		for _, Error := range animeResponse.Errors {
-			logger.Error("GraphQL error", "message", Error.Message)
-		}
+	if len(sliceAnime) == 0 {
+		return nil, ErrAnimeNotFound
 	}
 
-	return animeResponse.Data.Animes, nil
+	return &sliceAnime[0], nil
 }
@@ -0,0 +1,104 @@
+package animes_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"smOwd/animes"
+	"smOwd/animes/shikifake"
+)
+
+func TestSearchAnimeByNameHostileInput(t *testing.T) {
+	fixtures, err := shikifake.LoadFixtures("shikifake/testdata/animes.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fake := shikifake.New(fixtures)
+	ts := fake.Start()
+	defer ts.Close()
+
+	source := animes.NewShikimori(ts.URL)
+	ctx := context.Background()
+
+	// A plain search first, its query text is what every search must send
+	sliceAnime, err := source.SearchAnimeByName(ctx, "frieren",
+		animes.SearchOptions{})
+	if err != nil {
+		t.Fatal(err)
+	} else if len(sliceAnime) == 0 || sliceAnime[0].ShikiID != "52991" {
+		t.Fatalf("search for frieren = %v, want 52991 first", sliceAnime)
+	}
+
+	query := fake.Requests()[0].Query
+
+	inputs := []string{
+		`"`,
+		`\`,
+		`\"`,
+		`frieren"`,
+		`"}) { __schema { types { name } } }`,
+		`"}) { __schema { types { name } } } #`,
+		"line\nbreak",
+		"tab\tand\r\nreturn",
+		"葬送のフリーレン",
+		"Провожающая",
+		"emoji 🎉",
+		"'; DROP TABLE users; --",
+		"$search",
+	}
+
+	for i, input := range inputs {
+		_, err := source.SearchAnimeByName(ctx, input, animes.SearchOptions{})
+		if err != nil {
+			t.Errorf("search for %q: %v", input, err)
+			continue
+		}
+
+		req := fake.Requests()[i+1]
+
+		if got := req.Variables["search"]; got != input {
+			t.Errorf("search for %q sent search variable %q", input, got)
+		}
+
+		if req.Query != query {
+			t.Errorf("search for %q sent query\n%s\nwant\n%s",
+				input, req.Query, query)
+		}
+	}
+
+	if strings.Contains(query, "__schema") {
+		t.Errorf("query text contains input: %s", query)
+	}
+}
+
+func TestSearchAnimeByNameLimit(t *testing.T) {
+	fake := shikifake.New(nil)
+	ts := fake.Start()
+	defer ts.Close()
+
+	source := animes.NewShikimori(ts.URL)
+
+	tests := []struct {
+		limit int
+		want  float64 // as encoding/json decodes it
+	}{
+		{0, 50},
+		{10, 10},
+		{50, 50},
+		{500, 50},
+	}
+
+	for i, tt := range tests {
+		_, err := source.SearchAnimeByName(context.Background(), "x",
+			animes.SearchOptions{Limit: tt.limit})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := fake.Requests()[i].Variables["limit"]; got != tt.want {
+			t.Errorf("Limit %d sent limit %v, want %v", tt.limit, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package animes
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// ErrUnavailable matches the errors worth retrying later: the catalog
+// couldn't be reached, was overloaded or broken (429 or 5xx), or sent a
+// body that can't be parsed. It doesn't match the caller giving up, other
+// 4xx answers or GraphQL errors, which retrying won't fix.
+var ErrUnavailable = errors.New("anime catalog unavailable")
+
+// NetworkError is returned when the request or reading the response failed,
+// including when the caller's context was cancelled.
+type NetworkError struct {
+	Err error
+}
+
+func (e *NetworkError) Error() string {
+	return "anime catalog request failed: " + e.Err.Error()
+}
+
+func (e *NetworkError) Unwrap() error { return e.Err }
+
+func (e *NetworkError) Is(target error) bool {
+	return target == ErrUnavailable && !errors.Is(e.Err, context.Canceled)
+}
+
+// StatusError is returned when the catalog answers with a non-2xx status.
+type StatusError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("anime catalog returned HTTP %d: %s", e.StatusCode, e.Body)
+}
+
+func (e *StatusError) Is(target error) bool {
+	return target == ErrUnavailable &&
+		(e.StatusCode == http.StatusTooManyRequests || e.StatusCode >= 500)
+}
+
+// DecodeError is returned when the response body isn't the JSON expected.
+type DecodeError struct {
+	Err error
+}
+
+func (e *DecodeError) Error() string {
+	return "failed to decode anime catalog response: " + e.Err.Error()
+}
+
+func (e *DecodeError) Unwrap() error { return e.Err }
+
+func (e *DecodeError) Is(target error) bool { return target == ErrUnavailable }
+
+// GraphQLError carries the errors array of a GraphQL response.
+type GraphQLError struct {
+	Messages []string
+}
+
+func (e *GraphQLError) Error() string {
+	return "anime catalog GraphQL error: " + strings.Join(e.Messages, "; ")
+}
@@ -0,0 +1,39 @@
+package animes
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestErrUnavailable(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"network", &NetworkError{Err: errors.New("connection refused")}, true},
+		{"deadline", &NetworkError{Err: context.DeadlineExceeded}, true},
+		{"rate limited", &NetworkError{Err: ErrRateLimited}, true},
+		{"cancelled", &NetworkError{Err: context.Canceled}, false},
+		{"wrapped cancel", &NetworkError{
+			Err: fmt.Errorf("Post: %w", context.Canceled)}, false},
+		{"429", &StatusError{StatusCode: 429}, true},
+		{"500", &StatusError{StatusCode: 500}, true},
+		{"503", &StatusError{StatusCode: 503}, true},
+		{"400", &StatusError{StatusCode: 400}, false},
+		{"404", &StatusError{StatusCode: 404}, false},
+		{"decode", &DecodeError{Err: errors.New("unexpected EOF")}, true},
+		{"graphql", &GraphQLError{Messages: []string{"bad field"}}, false},
+		{"not found", ErrAnimeNotFound, false},
+		{"wrapped", fmt.Errorf("search: %w", &StatusError{StatusCode: 502}), true},
+	}
+
+	for _, tt := range tests {
+		if got := errors.Is(tt.err, ErrUnavailable); got != tt.want {
+			t.Errorf("%s: errors.Is(%v, ErrUnavailable) = %v, want %v",
+				tt.name, tt.err, got, tt.want)
+		}
+	}
+}
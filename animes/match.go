@@ -0,0 +1,153 @@
+package animes
+
+import (
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// Relevance scores, from best to worst. A title scoring 0 still stays in
+// the results: Shikimori matched it on something we don't see.
+const (
+	scoreExact     = 100
+	scoreSubstring = 80
+	scoreAllWords  = 60
+	scoreSomeWords = 40
+)
+
+// RankByRelevance orders sliceAnime by how well any of their titles
+// (English, Russian, Japanese, romaji or a synonym) matches query. Ties keep
+// the catalog's own order.
+func RankByRelevance(query string, sliceAnime []Anime) []Anime {
+	queryNorm := normalize(query)
+	queryWords := strings.Fields(queryNorm)
+
+	scores := make(map[string]float64, len(sliceAnime))
+	for _, a := range sliceAnime {
+		scores[a.ShikiID] = relevance(queryNorm, queryWords, a)
+	}
+
+	result := slices.Clone(sliceAnime)
+	slices.SortStableFunc(result, func(a, b Anime) int {
+		switch sa, sb := scores[a.ShikiID], scores[b.ShikiID]; {
+		case sa > sb:
+			return -1
+		case sa < sb:
+			return 1
+		}
+		return 0
+	})
+
+	return result
+}
+
+func titles(a Anime) []string {
+	return append([]string{a.English, a.Russian, a.Japanese, a.Name},
+		a.Synonyms...)
+}
+
+func relevance(queryNorm string, queryWords []string, a Anime) float64 {
+	best := 0.0
+
+	for _, title := range titles(a) {
+		if score := titleRelevance(queryNorm, queryWords, normalize(title)); score > best {
+			best = score
+		}
+	}
+
+	return best
+}
+
+func titleRelevance(queryNorm string, queryWords []string, title string) float64 {
+	if title == "" || queryNorm == "" {
+		return 0
+	}
+
+	if title == queryNorm {
+		return scoreExact
+	}
+
+	// Also covers scripts written without spaces, like Japanese
+	if strings.Contains(title, queryNorm) {
+		return scoreSubstring
+	}
+
+	titleWords := strings.Fields(title)
+	matched := 0
+
+	for _, qw := range queryWords {
+		for _, tw := range titleWords {
+			if wordsMatch(qw, tw) {
+				matched++
+				break
+			}
+		}
+	}
+
+	if matched == len(queryWords) {
+		return scoreAllWords
+	}
+
+	return scoreSomeWords * float64(matched) / float64(len(queryWords))
+}
+
+// wordsMatch accepts a typed prefix of a word or a small typo in it.
+func wordsMatch(queryWord, titleWord string) bool {
+	if strings.HasPrefix(titleWord, queryWord) {
+		return true
+	}
+
+	return editDistance(queryWord, titleWord) <= maxTypos(queryWord)
+}
+
+// maxTypos is the edit distance tolerated for a word of this length.
+func maxTypos(word string) int {
+	switch n := len([]rune(word)); {
+	case n <= 3:
+		return 0
+	case n <= 7:
+		return 1
+	default:
+		return 2
+	}
+}
+
+// normalize lowercases s and turns punctuation and underscores into spaces.
+func normalize(s string) string {
+	return strings.Join(strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}), " ")
+}
+
+// editDistance is the optimal string alignment distance: insertions,
+// deletions, substitutions and swaps of adjacent letters cost one each.
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+
+	d := make([][]int, len(ra)+1)
+	for i := range d {
+		d[i] = make([]int, len(rb)+1)
+		d[i][0] = i
+	}
+
+	for j := range d[0] {
+		d[0][j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+
+			d[i][j] = min(d[i-1][j]+1, d[i][j-1]+1, d[i-1][j-1]+cost)
+
+			if i > 1 && j > 1 && ra[i-1] == rb[j-2] && ra[i-2] == rb[j-1] {
+				d[i][j] = min(d[i][j], d[i-2][j-2]+1)
+			}
+		}
+	}
+
+	return d[len(ra)][len(rb)]
+}
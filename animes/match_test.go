@@ -0,0 +1,103 @@
+package animes
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestEditDistance(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"", "", 0},
+		{"", "abc", 3},
+		{"abc", "", 3},
+		{"frieren", "frieren", 0},
+		{"frieren", "freiren", 1}, // adjacent swap
+		{"frieren", "frieen", 1},  // deletion
+		{"frieren", "frierren", 1},
+		{"frieren", "friaren", 1},
+		{"ca", "abc", 3}, // optimal string alignment, not full Damerau
+		{"kitten", "sitting", 3},
+		{"фрирен", "фририн", 1}, // counted in runes
+		{"葬送", "葬送の", 1},
+	}
+
+	for _, tt := range tests {
+		if got := editDistance(tt.a, tt.b); got != tt.want {
+			t.Errorf("editDistance(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+
+		if got := editDistance(tt.b, tt.a); got != tt.want {
+			t.Errorf("editDistance(%q, %q) = %d, want %d", tt.b, tt.a, got, tt.want)
+		}
+	}
+}
+
+func TestWordsMatch(t *testing.T) {
+	tests := []struct {
+		query, title string
+		want         bool
+	}{
+		{"fri", "frieren", true},  // prefix
+		{"fre", "frieren", false}, // no typos in short words
+		{"frein", "frieren", false},
+		{"freiren", "frieren", true},
+		{"attak", "attack", true},
+		{"shingekii", "shingeki", true},
+		{"shngk", "shingeki", false},
+	}
+
+	for _, tt := range tests {
+		if got := wordsMatch(tt.query, tt.title); got != tt.want {
+			t.Errorf("wordsMatch(%q, %q) = %v, want %v",
+				tt.query, tt.title, got, tt.want)
+		}
+	}
+}
+
+func TestRankByRelevance(t *testing.T) {
+	sliceAnime := []Anime{
+		{ShikiID: "1", English: "Frieren Recap"},
+		{ShikiID: "2", English: "Something Else"},
+		{ShikiID: "3", Name: "Sousou no Frieren"},
+		{ShikiID: "4", English: "Frieren"},
+		{ShikiID: "5", Synonyms: []string{"Frieren at the Funeral"}},
+		{ShikiID: "6", Russian: "Провожающая в последний путь Фрирен"},
+		{ShikiID: "7", English: "Beyond Journey's End", Japanese: "葬送のフリーレン"},
+	}
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		// Exact first, substrings in catalog order, the rest after
+		{"Frieren", []string{"4", "1", "3", "5", "2", "6", "7"}},
+		{"  FRIEREN!! ", []string{"4", "1", "3", "5", "2", "6", "7"}},
+		// Every word matched with a typo beats a partial match
+		{"freiren funeral", []string{"5", "1", "3", "4", "2", "6", "7"}},
+		{"фрирен", []string{"6", "1", "2", "3", "4", "5", "7"}},
+		{"フリーレン", []string{"7", "1", "2", "3", "4", "5", "6"}},
+		{"journeys end", []string{"7", "1", "2", "3", "4", "5", "6"}},
+		// Nothing matches: the catalog's order is kept
+		{"zzz", []string{"1", "2", "3", "4", "5", "6", "7"}},
+		{"", []string{"1", "2", "3", "4", "5", "6", "7"}},
+	}
+
+	for _, tt := range tests {
+		var got []string
+
+		for _, a := range RankByRelevance(tt.query, sliceAnime) {
+			got = append(got, a.ShikiID)
+		}
+
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("RankByRelevance(%q) = %v, want %v", tt.query, got, tt.want)
+		}
+	}
+
+	if sliceAnime[0].ShikiID != "1" || sliceAnime[3].ShikiID != "4" {
+		t.Error("RankByRelevance reordered its input")
+	}
+}
@@ -0,0 +1,244 @@
+package animes
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Shikimori allows roughly 5 requests per second and 90 per minute.
+const (
+	requestsPerSecond = 5
+	requestsPerMinute = 90
+)
+
+// ErrRateLimited is returned when a request would have to wait for the rate
+// limiter past its context's deadline. It is not sent at all then.
+var ErrRateLimited = errors.New("rate limit wait exceeds deadline")
+
+// tokenBucket hands out tokens at a fixed rate up to capacity. Callers that
+// find it empty get in line by borrowing against future refills, as far as
+// their deadline allows.
+type tokenBucket struct {
+	mu       sync.Mutex
+	capacity float64
+	tokens   float64
+	perSec   float64
+	last     time.Time
+}
+
+func newTokenBucket(capacity int, per time.Duration) *tokenBucket {
+	return &tokenBucket{
+		capacity: float64(capacity),
+		tokens:   float64(capacity),
+		perSec:   float64(capacity) / per.Seconds(),
+		last:     time.Now(),
+	}
+}
+
+// reserve takes a token and returns how long the caller must wait for it.
+// If the wait would end after deadline, it takes nothing and reports false;
+// a zero deadline means no limit.
+func (b *tokenBucket) reserve(deadline time.Time) (time.Duration, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	b.tokens += now.Sub(b.last).Seconds() * b.perSec
+	if b.tokens > b.capacity {
+		b.tokens = b.capacity
+	}
+	b.last = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return 0, true
+	}
+
+	d := time.Duration((1 - b.tokens) / b.perSec * float64(time.Second))
+
+	if !deadline.IsZero() && now.Add(d).After(deadline) {
+		return 0, false
+	}
+
+	b.tokens--
+	return d, true
+}
+
+// cancel gives back a token taken by reserve.
+func (b *tokenBucket) cancel() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.tokens++
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// RateLimitedClient wraps an http.Client so every request stays within the
+// Shikimori rate limits, and retries 429 and 5xx answers with jittered
+// exponential backoff, honouring Retry-After when the server sends one. A
+// Retry-After longer than maxDelay isn't waited for, the answer is returned
+// as it is. A request whose context deadline comes before its turn fails
+// with ErrRateLimited instead of queueing.
+type RateLimitedClient struct {
+	client     *http.Client
+	buckets    []*tokenBucket
+	maxRetries int
+	baseDelay  time.Duration
+	maxDelay   time.Duration
+}
+
+func NewRateLimitedClient(client *http.Client) *RateLimitedClient {
+	return &RateLimitedClient{
+		client:     client,
+		buckets:    rateBuckets(1),
+		maxRetries: 4,
+		baseDelay:  500 * time.Millisecond,
+		maxDelay:   30 * time.Second,
+	}
+}
+
+// Do sends req, waiting for the rate limiter first. The request body must
+// be rewindable (req.GetBody set), as it is for bytes.Buffer bodies.
+func (c *RateLimitedClient) Do(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+
+	for attempt := 0; ; attempt++ {
+		if err := c.wait(ctx); err != nil {
+			return nil, err
+		}
+
+		attemptReq := req
+		if attempt > 0 && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			attemptReq = req.Clone(ctx)
+			attemptReq.Body = body
+		}
+
+		resp, err := c.client.Do(attemptReq)
+
+		if attempt >= c.maxRetries || !retryable(ctx, resp, err) {
+			return resp, err
+		}
+
+		delay := c.backoff(attempt)
+
+		if resp != nil {
+			if retryAfter, ok := parseRetryAfter(resp.Header.Get("Retry-After")); ok {
+				if retryAfter > c.maxDelay {
+					// Not worth holding a chat up for, let the caller fail
+					return resp, nil
+				}
+				delay = retryAfter
+			}
+			resp.Body.Close()
+		}
+
+		if err := sleep(ctx, delay); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// wait takes a token from every bucket and waits for the last of them. It
+// returns ErrRateLimited without taking any when that would outlast ctx.
+func (c *RateLimitedClient) wait(ctx context.Context) error {
+	deadline, _ := ctx.Deadline()
+
+	var longest time.Duration
+
+	for i, b := range c.buckets {
+		d, ok := b.reserve(deadline)
+
+		if !ok {
+			for _, taken := range c.buckets[:i] {
+				taken.cancel()
+			}
+			return ErrRateLimited
+		}
+
+		longest = max(longest, d)
+	}
+
+	return sleep(ctx, longest)
+}
+
+// rateBuckets are the Shikimori limits scaled down to share of them,
+// rounded down but at least one request per period.
+func rateBuckets(share float64) []*tokenBucket {
+	return []*tokenBucket{
+		newTokenBucket(max(1, int(requestsPerSecond*share)), time.Second),
+		newTokenBucket(max(1, int(requestsPerMinute*share)), time.Minute),
+	}
+}
+
+// SetRateShare limits every Shikimori source in this process to share of
+// the Shikimori rate limits, 0 < share <= 1. The limits are per client IP,
+// so processes sharing one split them between them. Call it before the
+// first request.
+func SetRateShare(share float64) {
+	if share <= 0 || share > 1 {
+		share = 1
+	}
+	client.buckets = rateBuckets(share)
+}
+
+func retryable(ctx context.Context, resp *http.Response, err error) bool {
+	if err != nil {
+		// A cancelled context is the caller giving up, not a hiccup.
+		return ctx.Err() == nil
+	}
+
+	return resp.StatusCode == http.StatusTooManyRequests ||
+		resp.StatusCode >= 500
+}
+
+// backoff returns base*2^attempt capped at maxDelay, with jitter picked
+// from the upper half so retries from several callers spread out.
+func (c *RateLimitedClient) backoff(attempt int) time.Duration {
+	d := c.baseDelay << attempt
+	if d <= 0 || d > c.maxDelay {
+		d = c.maxDelay
+	}
+
+	return d/2 + rand.N(d/2+1)
+}
+
+// parseRetryAfter understands both the delay-seconds and HTTP-date forms.
+func parseRetryAfter(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	if t, err := http.ParseTime(value); err == nil {
+		return time.Until(t), true
+	}
+
+	return 0, false
+}
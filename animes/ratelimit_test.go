@@ -0,0 +1,287 @@
+package animes
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestParseRetryAfter(t *testing.T) {
+	tests := []struct {
+		value  string
+		want   time.Duration
+		wantOK bool
+	}{
+		{"", 0, false},
+		{"0", 0, true},
+		{"5", 5 * time.Second, true},
+		{"3600", time.Hour, true},
+		{"-1", 0, false},
+		{"1.5", 0, false},
+		{"soon", 0, false},
+	}
+
+	for _, tt := range tests {
+		got, ok := parseRetryAfter(tt.value)
+
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("parseRetryAfter(%q) = %v, %v, want %v, %v",
+				tt.value, got, ok, tt.want, tt.wantOK)
+		}
+	}
+
+	date := time.Now().Add(time.Minute).UTC().Format(http.TimeFormat)
+
+	got, ok := parseRetryAfter(date)
+
+	if !ok || got <= 58*time.Second || got > time.Minute {
+		t.Errorf("parseRetryAfter(%q) = %v, %v, want about a minute",
+			date, got, ok)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	c := &RateLimitedClient{
+		baseDelay: 500 * time.Millisecond,
+		maxDelay:  30 * time.Second,
+	}
+
+	tests := []struct {
+		attempt int
+		ceiling time.Duration
+	}{
+		{0, 500 * time.Millisecond},
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{5, 16 * time.Second},
+		{6, 30 * time.Second},
+		{20, 30 * time.Second},
+		{70, 30 * time.Second}, // shifted out of range
+	}
+
+	for _, tt := range tests {
+		for range 100 {
+			got := c.backoff(tt.attempt)
+
+			if got < tt.ceiling/2 || got > tt.ceiling {
+				t.Fatalf("backoff(%d) = %v, want within [%v, %v]",
+					tt.attempt, got, tt.ceiling/2, tt.ceiling)
+			}
+		}
+	}
+}
+
+// testClient retries quickly and is never held up by its rate limits.
+func testClient() *RateLimitedClient {
+	return &RateLimitedClient{
+		client:     &http.Client{Timeout: 5 * time.Second},
+		buckets:    []*tokenBucket{newTokenBucket(1000, time.Second)},
+		maxRetries: 4,
+		baseDelay:  time.Millisecond,
+		maxDelay:   20 * time.Millisecond,
+	}
+}
+
+// flakyServer answers with the statuses in turn, then 200, and records the
+// bodies it was sent.
+type flakyServer struct {
+	mu         sync.Mutex
+	statuses   []int
+	retryAfter string
+	bodies     []string
+}
+
+func (s *flakyServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.bodies = append(s.bodies, string(body))
+
+	if len(s.statuses) == 0 {
+		w.Write([]byte("ok"))
+		return
+	}
+
+	status := s.statuses[0]
+	s.statuses = s.statuses[1:]
+
+	if s.retryAfter != "" {
+		w.Header().Set("Retry-After", s.retryAfter)
+	}
+
+	w.WriteHeader(status)
+}
+
+func TestRateLimitedClientDo(t *testing.T) {
+	tests := []struct {
+		name       string
+		statuses   []int
+		retryAfter string
+		wantStatus int
+		wantCalls  int
+	}{
+		{"ok", nil, "", 200, 1},
+		{"429 then ok", []int{429}, "", 200, 2},
+		{"5xx then ok", []int{500, 502, 503}, "", 200, 4},
+		{"short Retry-After", []int{429}, "0", 200, 2},
+		{"long Retry-After", []int{429}, "3600", 429, 1},
+		{"4xx", []int{400}, "", 400, 1},
+		{"out of retries", []int{503, 503, 503, 503, 503, 503}, "", 503, 5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := &flakyServer{statuses: tt.statuses, retryAfter: tt.retryAfter}
+			ts := httptest.NewServer(fake)
+			defer ts.Close()
+
+			req, err := http.NewRequest("POST", ts.URL,
+				bytes.NewBufferString(`{"query":"q"}`))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			start := time.Now()
+
+			resp, err := testClient().Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+
+			if time.Since(start) > time.Second {
+				t.Errorf("took %v", time.Since(start))
+			}
+
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("status %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+
+			if len(fake.bodies) != tt.wantCalls {
+				t.Fatalf("%d requests, want %d", len(fake.bodies), tt.wantCalls)
+			}
+
+			for i, body := range fake.bodies {
+				if body != `{"query":"q"}` {
+					t.Errorf("request %d body %q, want it rewound",
+						i, body)
+				}
+			}
+		})
+	}
+}
+
+func TestTokenBucketReserve(t *testing.T) {
+	b := newTokenBucket(5, time.Second)
+
+	for i := range 5 {
+		if d, _ := b.reserve(time.Time{}); d != 0 {
+			t.Fatalf("token %d waits %v, want none within capacity", i, d)
+		}
+	}
+
+	// Each token past capacity waits another 1/5 of a second
+	for i := 1; i <= 3; i++ {
+		want := time.Duration(i) * time.Second / 5
+
+		if d, _ := b.reserve(time.Time{}); d < want-10*time.Millisecond || d > want {
+			t.Errorf("token %d waits %v, want about %v", 5+i, d, want)
+		}
+	}
+}
+
+func TestTokenBucketReserveDeadline(t *testing.T) {
+	b := newTokenBucket(5, time.Second)
+
+	for range 5 {
+		b.reserve(time.Time{})
+	}
+
+	// The next token is 1/5 of a second away
+	if d, ok := b.reserve(time.Now().Add(100 * time.Millisecond)); ok {
+		t.Fatalf("reserve past the deadline = %v, true, want refused", d)
+	}
+
+	if d, ok := b.reserve(time.Now().Add(time.Second)); !ok ||
+		d > time.Second/5 {
+		t.Errorf("reserve within the deadline = %v, %v, want at most %v, "+
+			"the refused call taking nothing", d, ok, time.Second/5)
+	}
+}
+
+func TestRateLimitedClientRefusesPastDeadline(t *testing.T) {
+	fake := &flakyServer{}
+	ts := httptest.NewServer(fake)
+	defer ts.Close()
+
+	c := testClient()
+	c.buckets = []*tokenBucket{
+		newTokenBucket(10, time.Second),
+		newTokenBucket(1, time.Minute),
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	for i, want := range []error{nil, ErrRateLimited, ErrRateLimited} {
+		req, err := http.NewRequestWithContext(ctx, "POST", ts.URL, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		start := time.Now()
+
+		resp, err := c.Do(req)
+		if err == nil {
+			resp.Body.Close()
+		}
+
+		if !errors.Is(err, want) || (want == nil && err != nil) {
+			t.Errorf("request %d: %v, want %v", i, err, want)
+		}
+
+		if time.Since(start) > 100*time.Millisecond {
+			t.Errorf("request %d took %v, want refused right away",
+				i, time.Since(start))
+		}
+	}
+
+	if len(fake.bodies) != 1 {
+		t.Errorf("%d requests sent, want 1", len(fake.bodies))
+	}
+
+	// Refused requests gave the per-second tokens back
+	if tokens := c.buckets[0].tokens; tokens < 8.9 {
+		t.Errorf("%v per-second tokens left, want 9", tokens)
+	}
+}
+
+func TestRateBuckets(t *testing.T) {
+	tests := []struct {
+		share             float64
+		perSec, perMinute float64
+	}{
+		{1, 5, 90},
+		{0.7, 3, 62},
+		{0.3, 1, 27},
+		{0.01, 1, 1},
+	}
+
+	for _, tt := range tests {
+		buckets := rateBuckets(tt.share)
+
+		if buckets[0].capacity != tt.perSec || buckets[1].capacity != tt.perMinute {
+			t.Errorf("rateBuckets(%v) = %v/s and %v/min, want %v and %v",
+				tt.share, buckets[0].capacity, buckets[1].capacity,
+				tt.perSec, tt.perMinute)
+		}
+	}
+}
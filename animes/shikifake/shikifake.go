@@ -0,0 +1,191 @@
+// Package shikifake is an in-process stand-in for the Shikimori GraphQL API.
+// It answers the animes(search: ...) and animes(ids: ...) queries issued by
+// animes.Shikimori from a fixture set, so the bot can run without network.
+package shikifake
+
+import (
+	_ "embed"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"smOwd/animes"
+	"strings"
+	"sync"
+)
+
+type Server struct {
+	mu       sync.Mutex
+	animes   []animes.Anime
+	requests []animes.GraphQLRequest
+}
+
+// New returns a fake serving the given fixtures.
+func New(fixtures []animes.Anime) *Server {
+	s := &Server{}
+	s.SetAnimes(fixtures)
+	return s
+}
+
+//go:embed testdata/animes.json
+var defaultFixtures []byte
+
+// DefaultFixtures returns the fixtures shipped with the package, the same
+// as testdata/animes.json, wherever the caller runs from.
+func DefaultFixtures() ([]animes.Anime, error) {
+	return parseFixtures(defaultFixtures)
+}
+
+// LoadFixtures reads a JSON array of animes in the GraphQL response shape.
+func LoadFixtures(path string) ([]animes.Anime, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseFixtures(data)
+}
+
+func parseFixtures(data []byte) ([]animes.Anime, error) {
+	var fixtures []animes.Anime
+
+	if err := json.Unmarshal(data, &fixtures); err != nil {
+		return nil, err
+	}
+
+	return fixtures, nil
+}
+
+// Start serves the fake on a local httptest server. Point
+// animes.NewShikimori at the returned server's URL.
+func (s *Server) Start() *httptest.Server {
+	return httptest.NewServer(s)
+}
+
+func (s *Server) SetAnimes(fixtures []animes.Anime) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.animes = append([]animes.Anime(nil), fixtures...)
+}
+
+// UpdateAnime applies fn to the fixture with the given id, e.g. to bump
+// EpisodesAired and trigger a notification. It reports whether it was found.
+func (s *Server) UpdateAnime(shikiID string, fn func(a *animes.Anime)) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.animes {
+		if s.animes[i].ShikiID == shikiID {
+			fn(&s.animes[i])
+			return true
+		}
+	}
+	return false
+}
+
+// Requests returns every GraphQL request received so far.
+func (s *Server) Requests() []animes.GraphQLRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]animes.GraphQLRequest(nil), s.requests...)
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req animes.GraphQLRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	s.requests = append(s.requests, req)
+	s.mu.Unlock()
+
+	var resp animes.AnimeResponse
+
+	if ids, ok := req.Variables["ids"].(string); ok {
+		resp.Data.Animes = s.byIDs(strings.Split(ids, ","))
+	} else if search, ok := req.Variables["search"].(string); ok {
+		resp.Data.Animes = paginate(s.search(search,
+			stringVariable(req, "kind"), stringVariable(req, "status")),
+			intVariable(req, "page", 1), intVariable(req, "limit", 50))
+	} else {
+		resp.Errors = append(resp.Errors,
+			animes.ResponseError{Message: "shikifake: unsupported query"})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+func (s *Server) byIDs(ids []string) []animes.Anime {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result := []animes.Anime{}
+
+	for _, id := range ids {
+		for _, a := range s.animes {
+			if a.ShikiID == strings.TrimSpace(id) {
+				result = append(result, a)
+			}
+		}
+	}
+	return result
+}
+
+// search matches the term literally against every title, so hostile input
+// (quotes, braces, GraphQL fragments) simply finds nothing.
+func (s *Server) search(term, kind, status string) []animes.Anime {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	term = strings.ToLower(term)
+	result := []animes.Anime{}
+
+	for _, a := range s.animes {
+		if (kind != "" && a.Kind != kind) || (status != "" && a.Status != status) {
+			continue
+		}
+		titles := append([]string{a.English, a.Russian, a.Japanese, a.Name},
+			a.Synonyms...)
+
+		for _, title := range titles {
+			if strings.Contains(strings.ToLower(title), term) {
+				result = append(result, a)
+				break
+			}
+		}
+	}
+	return result
+}
+
+func paginate(sliceAnime []animes.Anime, page, limit int) []animes.Anime {
+	start := (page - 1) * limit
+	if start < 0 || start >= len(sliceAnime) {
+		return []animes.Anime{}
+	}
+
+	return sliceAnime[start:min(start+limit, len(sliceAnime))]
+}
+
+func stringVariable(req animes.GraphQLRequest, name string) string {
+	value, _ := req.Variables[name].(string)
+	return value
+}
+
+// intVariable reads a numeric variable, which encoding/json decodes as float64.
+func intVariable(req animes.GraphQLRequest, name string, def int) int {
+	if value, ok := req.Variables[name].(float64); ok && value > 0 {
+		return int(value)
+	}
+	return def
+}
@@ -0,0 +1,136 @@
+// Package cards renders animes as Telegram cards: the poster with a caption
+// describing the anime, used by the chat screens and by notifications.
+package cards
+
+import (
+	"fmt"
+	"html"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"smOwd/animes"
+
+	"github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+// captionLimit is the most characters Telegram takes in a photo caption.
+// Longer cards go out as text.
+const captionLimit = 1024
+
+// Sender is the part of tgbot.Messenger and tgbotapi.BotAPI that sends
+// messages.
+type Sender interface {
+	Send(c tgbotapi.Chattable) (tgbotapi.Message, error)
+}
+
+// Send sends a card of a: its poster with Text as the caption and
+// keyboard under it. header, if not empty, goes on top, e.g. "New episode
+// 5!". Without a poster, or when Telegram can't fetch it, the card is sent
+// as text.
+func Send(bot Sender, chatID int64, a animes.Anime, header string,
+	keyboard *tgbotapi.InlineKeyboardMarkup) (tgbotapi.Message, error) {
+	text := Text(a)
+
+	if header != "" {
+		text = "<b>" + html.EscapeString(header) + "</b>\n\n" + text
+	}
+
+	if poster := posterURL(a); poster != "" &&
+		utf8.RuneCountInString(text) <= captionLimit {
+		photo := tgbotapi.NewPhotoShare(chatID, poster)
+		photo.Caption = text
+		photo.ParseMode = tgbotapi.ModeHTML
+
+		if keyboard != nil {
+			photo.ReplyMarkup = *keyboard
+		}
+
+		sent, err := bot.Send(photo)
+
+		if err == nil {
+			return sent, nil
+		}
+	}
+
+	msg := tgbotapi.NewMessage(chatID, text)
+	msg.ParseMode = tgbotapi.ModeHTML
+	msg.DisableWebPagePreview = true
+
+	if keyboard != nil {
+		msg.ReplyMarkup = *keyboard
+	}
+
+	return bot.Send(msg)
+}
+
+// Text describes a in HTML: its titles in every language it has, status,
+// episodes, score, when the next episode airs and a link to Shikimori.
+func Text(a animes.Anime) string {
+	var titles []string
+
+	for _, title := range []string{a.English, a.Name, a.Russian, a.Japanese} {
+		seen := slices.ContainsFunc(titles, func(t string) bool {
+			return strings.EqualFold(t, title)
+		})
+
+		if title != "" && !seen {
+			titles = append(titles, title)
+		}
+	}
+
+	if len(titles) == 0 {
+		titles = append(titles, a.ShikiID)
+	}
+
+	var b strings.Builder
+
+	b.WriteString("<b>" + html.EscapeString(titles[0]) + "</b>\n")
+
+	for _, title := range titles[1:] {
+		b.WriteString(html.EscapeString(title) + "\n")
+	}
+
+	b.WriteString("\nStatus: " + html.EscapeString(a.Status))
+
+	if a.Episodes > 0 {
+		fmt.Fprintf(&b, "\nEpisodes: %d/%d", a.EpisodesAired, a.Episodes)
+	} else {
+		fmt.Fprintf(&b, "\nEpisodes: %d", a.EpisodesAired)
+	}
+
+	if a.Score > 0 {
+		fmt.Fprintf(&b, "\nScore: %.2f", a.Score)
+	}
+
+	if a.NextEpisodeAt != nil && a.Status != "released" {
+		b.WriteString("\nNext episode: " +
+			a.NextEpisodeAt.UTC().Format("Mon, 2 Jan 15:04 MST"))
+	}
+
+	if a.URL != "" {
+		b.WriteString("\n\n<a href=\"" + html.EscapeString(a.URL) +
+			"\">Shikimori</a>")
+	}
+
+	return b.String()
+}
+
+// posterURL is the largest poster of a, or empty when Shikimori has only its
+// "missing" placeholder.
+func posterURL(a animes.Anime) string {
+	if a.Poster == nil {
+		return ""
+	}
+
+	url := a.Poster.OriginalURL
+	if url == "" {
+		url = a.Poster.MainURL
+	}
+
+	if strings.Contains(url, "/missing_") {
+		return ""
+	}
+
+	return url
+}
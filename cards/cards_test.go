@@ -0,0 +1,59 @@
+package cards
+
+import (
+	"strings"
+	"testing"
+
+	"smOwd/animes"
+)
+
+func TestText(t *testing.T) {
+	a := animes.Anime{
+		ShikiID:       "52991",
+		Name:          "Sousou no Frieren",
+		English:       "Frieren <Beyond>",
+		Japanese:      "SOUSOU NO FRIEREN",
+		Status:        "ongoing",
+		Episodes:      28,
+		EpisodesAired: 3,
+		URL:           "https://shikimori.one/animes/52991",
+	}
+
+	text := Text(a)
+
+	for _, want := range []string{
+		"<b>Frieren &lt;Beyond&gt;</b>\n",
+		"Episodes: 3/28",
+		`<a href="https://shikimori.one/animes/52991">Shikimori</a>`,
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("Text = %q, want it to contain %q", text, want)
+		}
+	}
+
+	if strings.Count(strings.ToLower(text), "sousou no frieren") != 1 {
+		t.Errorf("Text = %q, want titles differing in case once", text)
+	}
+
+	if text := Text(animes.Anime{ShikiID: "1"}); !strings.HasPrefix(text, "<b>1</b>") {
+		t.Errorf("Text without titles = %q, want the id as title", text)
+	}
+}
+
+func TestPosterURL(t *testing.T) {
+	tests := []struct {
+		poster *animes.Poster
+		want   string
+	}{
+		{nil, ""},
+		{&animes.Poster{OriginalURL: "o.jpg", MainURL: "m.jpg"}, "o.jpg"},
+		{&animes.Poster{MainURL: "m.jpg"}, "m.jpg"},
+		{&animes.Poster{OriginalURL: "/assets/globals/missing_original.jpg"}, ""},
+	}
+
+	for _, tt := range tests {
+		if got := posterURL(animes.Anime{Poster: tt.poster}); got != tt.want {
+			t.Errorf("posterURL(%+v) = %q, want %q", tt.poster, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package cards
+
+import (
+	"smOwd/animes"
+
+	"github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+// Payload prefixes of /start deep links, as in
+// https://t.me/<bot>?start=sub_52991. The bot handles them whatever state
+// the chat is in, so links keep working on cards sent outside a
+// conversation, e.g. notifications and shared inline results.
+const (
+	SubscribePayloadPrefix   = "sub_"
+	UnsubscribePayloadPrefix = "unsub_"
+)
+
+// SubscribeLink opens the bot on shikiID's Subscribe offer.
+func SubscribeLink(botUserName string, shikiID string) string {
+	return "https://t.me/" + botUserName + "?start=" +
+		SubscribePayloadPrefix + shikiID
+}
+
+// UnsubscribeLink opens the bot asking whether to unsubscribe from shikiID.
+func UnsubscribeLink(botUserName string, shikiID string) string {
+	return "https://t.me/" + botUserName + "?start=" +
+		UnsubscribePayloadPrefix + shikiID
+}
+
+// NotificationKeyboard is the buttons under a notification about a:
+// Unsubscribe while the user still is, and Open on Shikimori. It is nil
+// when there are none.
+func NotificationKeyboard(a animes.Anime, botUserName string,
+	subscribed bool) *tgbotapi.InlineKeyboardMarkup {
+	var row []tgbotapi.InlineKeyboardButton
+
+	if subscribed {
+		row = append(row, tgbotapi.NewInlineKeyboardButtonURL("Unsubscribe",
+			UnsubscribeLink(botUserName, a.ShikiID)))
+	}
+
+	if a.URL != "" {
+		row = append(row, tgbotapi.NewInlineKeyboardButtonURL("Open on Shikimori",
+			a.URL))
+	}
+
+	if len(row) == 0 {
+		return nil
+	}
+
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(row)
+	return &keyboard
+}
@@ -0,0 +1,42 @@
+// Command fakeshiki serves the shikifake GraphQL API on a local address.
+// Run the bot with SHIKIMORI_URL pointing at it to exercise the
+// subscribe/notify flow offline.
+package main
+
+import (
+	"flag"
+	"log/slog"
+	"net/http"
+	"os"
+	"smOwd/animes"
+	"smOwd/animes/shikifake"
+	"smOwd/logs"
+)
+
+func main() {
+	logger := logs.New(slog.New(slog.NewTextHandler(os.Stderr, nil)))
+
+	addr := flag.String("addr", ":8081", "listen address")
+	fixtures := flag.String("fixtures", "",
+		"JSON file with anime fixtures, the built-in ones by default")
+	flag.Parse()
+
+	var sliceAnime []animes.Anime
+	var err error
+
+	if *fixtures != "" {
+		sliceAnime, err = shikifake.LoadFixtures(*fixtures)
+	} else {
+		sliceAnime, err = shikifake.DefaultFixtures()
+	}
+
+	if err != nil {
+		logger.Fatal("Failed to load fixtures", "path", *fixtures, "error", err)
+	}
+
+	logger.Info("Serving fake Shikimori", "addr", *addr, "animes", len(sliceAnime))
+
+	if err := http.ListenAndServe(*addr, shikifake.New(sliceAnime)); err != nil {
+		logger.Fatal("Fake Shikimori stopped", "error", err)
+	}
+}
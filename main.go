@@ -2,6 +2,11 @@ package main
 
 import (
 	"context"
+	"fmt"
+	"os/signal"
+	"strconv"
+	"sync"
+	"syscall"
 
 	"log/slog"
 	"os"
@@ -9,9 +14,12 @@ import (
 
 	"database/sql"
 	"smOwd/pql"
+	"smOwd/sessions"
 	"smOwd/subscriptions"
 
-	// "smOwd/animes"
+	"smOwd/animecache"
+	"smOwd/animes"
+	"smOwd/notifier"
 	"smOwd/tgbot"
 	"smOwd/users"
 	"time"
@@ -68,8 +76,56 @@ func testGracefulShutdown(cancel context.CancelFunc) {
 	cancel()
 }
 
+// Default shares of the Shikimori rate limits when the chat frontend and the
+// notifier run as separate processes, see SHIKIMORI_RATE_SHARE. Chats wait
+// on the catalog, the notifier can take its time.
+const (
+	botRateShare      = 0.7
+	notifierRateShare = 0.3
+)
+
+// rateShare is the part of the Shikimori rate limits this process may use:
+// SHIKIMORI_RATE_SHARE if set, else all of them when running both parts
+// and def when running only one.
+func rateShare(ctx context.Context, def float64) float64 {
+	value := os.Getenv("SHIKIMORI_RATE_SHARE")
+	if value == "" {
+		return def
+	}
+
+	share, err := strconv.ParseFloat(value, 64)
+	if err != nil || share <= 0 || share > 1 {
+		logs.DefaultFromCtx(ctx).Warn("SHIKIMORI_RATE_SHARE must be in (0, 1], ignoring",
+			"value", value)
+		return def
+	}
+	return share
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: smOwd [bot | notifier]")
+	fmt.Fprintln(os.Stderr, "  bot       run only the chat frontend")
+	fmt.Fprintln(os.Stderr, "  notifier  run only the episode notifier")
+	fmt.Fprintln(os.Stderr, "Without a command both run in one process.")
+}
+
 func main() {
 	// return
+	// Run the chat frontend and the notifier unless told otherwise
+	runBot, runNotifier := true, true
+
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "bot":
+			runNotifier = false
+		case "notifier":
+			runBot = false
+		default:
+			usage()
+			os.Exit(2)
+		}
+	}
+
 	// Initialize logger
 	logger := logs.New(slog.New(slog.NewTextHandler(os.Stderr, nil)))
 
@@ -79,6 +135,16 @@ func main() {
 
 	ctx = context.WithValue(ctx, "logger", logger)
 
+	// Set up a goroutine to listen for OS signals and trigger shutdown
+	go func() {
+		// Channel for receiving OS termination signals (e.g., CTRL+C or kill command)
+		signalChan := make(chan os.Signal, 1)
+		signal.Notify(signalChan, syscall.SIGINT, syscall.SIGTERM)
+		<-signalChan // Block until a signal is received
+		logger.Info("Received shutdown signal, shutting down gracefully...")
+		cancel() // Trigger the shutdown process
+	}()
+
 	LoadEnv(ctx)
 
 	pql.WaitPsql(ctx)
@@ -93,7 +159,71 @@ func main() {
 	CreateTableIfNotExistAndPrintInfo(ctx, db, "users", users.CreateTable)
 	CreateTableIfNotExistAndPrintInfo(ctx, db, "subscriptions",
 		subscriptions.CreateTable)
+	CreateTableIfNotExistAndPrintInfo(ctx, db, "anime_cache",
+		animecache.CreateTable)
+	animecache.Migrate(ctx, db)
+	CreateTableIfNotExistAndPrintInfo(ctx, db, "sessions", sessions.CreateTable)
+
+	share := 1.0
+	if !runBot {
+		share = notifierRateShare
+	} else if !runNotifier {
+		share = botRateShare
+	}
+
+	share = rateShare(ctx, share)
+	animes.SetRateShare(share)
+
+	logger.Info("Shikimori rate limit share", "share", share)
 
 	// return
-	tgbot.StartBotAndHandleUpdates(ctx, cancel, db)
+	source := animes.NewShikimori(os.Getenv("SHIKIMORI_URL"))
+
+	bot := tgbot.NewBotAPI(ctx)
+
+	var wg sync.WaitGroup
+
+	if runNotifier {
+		// The notifier always asks source and writes what it finds back to
+		// the anime cache
+		n := notifier.New(db, subscriptions.NewPostgresStore(db), bot, source)
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			n.Run(ctx)
+		}()
+	}
+
+	if runBot {
+		cacheTTL, err := time.ParseDuration(os.Getenv("ANIME_CACHE_TTL"))
+		if err != nil {
+			cacheTTL = animecache.DefaultTTL
+		}
+
+		catalog := animecache.New(db, source, cacheTTL)
+
+		sessionTTL, err := time.ParseDuration(os.Getenv("SESSION_TTL"))
+		if err != nil {
+			sessionTTL = sessions.DefaultTTL
+		}
+
+		store := sessions.NewPostgresStore(db, sessionTTL)
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			store.RunCleanup(ctx)
+		}()
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			tgbot.StartBotAndHandleUpdates(ctx, bot,
+				users.NewPostgresStore(db), subscriptions.NewPostgresStore(db),
+				catalog, store)
+		}()
+	}
+
+	wg.Wait()
 }
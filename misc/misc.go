@@ -24,71 +24,53 @@ func RemoveFirstCharIfPresent(s string, char rune) string {
 	return s // Return the string as is if the first character doesn't match
 }
 
-func СheckRangeFormat(s string) (bool, int, int) {
-	// Define the regex pattern for the "a-b" format
-	re := regexp.MustCompile(`^(\d+)-(\d+)$`)
-	matches := re.FindStringSubmatch(s)
+// maxSelectionRange caps ranges in ParseSelection, nobody has that many
+// subscriptions.
+const maxSelectionRange = 1000
 
-	// If no match found, return false
-	if matches == nil {
-		return false, 0, 0
-	}
-
-	// Parse the integers
-	a, errA := strconv.Atoi(matches[1])
-	b, errB := strconv.Atoi(matches[2])
-
-	// Check for any errors during conversion
-	if errA != nil || errB != nil {
-		return false, 0, 0
-	}
+// selectionPartRe is one part of a selection, a number or a range "a-b".
+var selectionPartRe = regexp.MustCompile(`^(\d+)(?:\s*-\s*(\d+))?$`)
 
-	// Ensure that a <= b
-	if a >= b {
-		return false, 0, 0
-	}
+// ParseSelection parses a list of numbers and ranges like "1-4, 7, 9" and
+// returns the numbers it covers, deduplicated and sorted. Numbers start
+// at 1, and a range may be a single number like "3-3".
+func ParseSelection(s string) (bool, []int) {
+	unique := make(map[int]struct{})
 
-	// Return true if the format is valid
-	return true, a, b
-}
+	for _, part := range strings.Split(s, ",") {
+		matches := selectionPartRe.FindStringSubmatch(strings.TrimSpace(part))
 
-// checkCommaSeparatedIntegers checks if the string consists of comma-separated integers,
-// removes duplicates, and sorts the output slice.
-func СheckCommaSeparatedIntegers(s string) (bool, []int) {
-	// Define the regex pattern for comma-separated integers
-	re := regexp.MustCompile(`^(\d+)(,\s*\d+)*$`)
+		if matches == nil {
+			return false, nil
+		}
 
-	// Check if the string matches the pattern
-	if !re.MatchString(s) {
-		return false, nil
-	}
+		a, err := strconv.Atoi(matches[1])
+		if err != nil {
+			return false, nil
+		}
 
-	// Split the string by commas and parse each part into an integer
-	parts := strings.Split(s, ",")
-	uniqueInts := make(map[int]struct{}) // Map to store unique integers
+		b := a
+		if matches[2] != "" {
+			if b, err = strconv.Atoi(matches[2]); err != nil {
+				return false, nil
+			}
+		}
 
-	for _, part := range parts {
-		// Trim spaces around each number
-		part = strings.TrimSpace(part)
-		// Convert the string part to an integer
-		num, err := strconv.Atoi(part)
-		if err != nil {
-			// If any part is not a valid integer, return false
+		if a < 1 || a > b || b-a >= maxSelectionRange {
 			return false, nil
 		}
-		// Add the integer to the map (duplicates are automatically removed)
-		uniqueInts[num] = struct{}{}
+
+		for i := a; i <= b; i++ {
+			unique[i] = struct{}{}
+		}
 	}
 
-	// Convert the map keys to a slice
 	var result []int
-	for num := range uniqueInts {
+	for num := range unique {
 		result = append(result, num)
 	}
 
-	// Sort the slice of integers
 	sort.Ints(result)
 
-	// Return true if all parts are valid integers, along with the sorted and deduplicated slice
 	return true, result
 }
@@ -0,0 +1,60 @@
+package misc
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParseSelection(t *testing.T) {
+	tests := []struct {
+		s      string
+		wantOK bool
+		want   []int
+	}{
+		{"1", true, []int{1}},
+		{"7", true, []int{7}},
+		{" 2 ", true, []int{2}},
+		{"1-4", true, []int{1, 2, 3, 4}},
+		{"1 - 4", true, []int{1, 2, 3, 4}},
+		{"3-3", true, []int{3}},
+		{"1-4, 7", true, []int{1, 2, 3, 4, 7}},
+		{"7, 1-2", true, []int{1, 2, 7}},
+		{"2,2,1-2", true, []int{1, 2}},
+		{"1-1000", true, nil}, // checked by length below
+		{"0", false, nil},
+		{"0-3", false, nil},
+		{"4-1", false, nil},
+		{"1-1001", false, nil},
+		{"", false, nil},
+		{"1,,2", false, nil},
+		{"1,", false, nil},
+		{"-1", false, nil},
+		{"+1", false, nil},
+		{"1-", false, nil},
+		{"a", false, nil},
+		{"1.5", false, nil},
+		{"1-2-3", false, nil},
+		{"99999999999999999999", false, nil},
+	}
+
+	for _, tt := range tests {
+		ok, got := ParseSelection(tt.s)
+
+		if ok != tt.wantOK {
+			t.Errorf("ParseSelection(%q) ok = %v, want %v", tt.s, ok, tt.wantOK)
+			continue
+		}
+
+		if tt.s == "1-1000" {
+			if len(got) != 1000 || got[0] != 1 || got[999] != 1000 {
+				t.Errorf("ParseSelection(%q) = %d numbers from %d",
+					tt.s, len(got), got[0])
+			}
+			continue
+		}
+
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("ParseSelection(%q) = %v, want %v", tt.s, got, tt.want)
+		}
+	}
+}
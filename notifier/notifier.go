@@ -0,0 +1,178 @@
+package notifier
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"smOwd/animecache"
+	"smOwd/animes"
+	"smOwd/cards"
+	"smOwd/logs"
+	"smOwd/subscriptions"
+
+	"github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+// Notifier watches subscribed animes and messages their subscribers when a
+// new episode airs or a show is released. It only needs the subscriptions
+// and a bot to send with, so it can run in its own process next to the chat
+// frontend.
+type Notifier struct {
+	db                *sql.DB
+	subscriptionStore subscriptions.SubscriptionStore
+	bot               *tgbotapi.BotAPI
+	source            animes.AnimeSource
+	sched             *scheduler
+}
+
+// New creates a Notifier looking animes up in source. Found animes are
+// written back to the anime cache in db for the chat frontend, unless db is
+// nil.
+func New(db *sql.DB, subscriptionStore subscriptions.SubscriptionStore,
+	bot *tgbotapi.BotAPI, source animes.AnimeSource) *Notifier {
+	return &Notifier{
+		db:                db,
+		subscriptionStore: subscriptionStore,
+		bot:               bot,
+		source:            source,
+		sched:             newScheduler(),
+	}
+}
+
+// Run checks for due animes right away and then every checkInterval until
+// ctx is done.
+func (n *Notifier) Run(ctx context.Context) {
+	logger := logs.DefaultFromCtx(ctx)
+
+	logger.Info("Notifier started", "interval", checkInterval)
+
+	ticker := time.NewTicker(checkInterval)
+	defer ticker.Stop()
+
+	for {
+		n.Check(ctx)
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			logger.Info("Stopping notifier due to shutdown signal.")
+			return
+		}
+	}
+}
+
+// releasedHeader tops the card sent when an anime has finished airing.
+const releasedHeader = "Released! You are no longer subscribed to this anime"
+
+// Check looks up the animes the scheduler says are due and notifies their
+// subscribers of new episodes and finished shows.
+func (n *Notifier) Check(ctx context.Context) {
+	logger := logs.DefaultFromCtx(ctx)
+
+	store, bot, sched := n.subscriptionStore, n.bot, n.sched
+	botUserName := bot.Self.UserName
+
+	sliceSubscribers := store.SelectAllEnabled(ctx)
+
+	if len(sliceSubscribers) == 0 {
+		logger.Debug("No subscriptions to check")
+		return
+	}
+
+	// Look every anime up once, however many users follow it
+	var shikiIDs []string
+	seen := make(map[string]bool)
+
+	for _, s := range sliceSubscribers {
+		if !seen[s.ShikiID] {
+			seen[s.ShikiID] = true
+			shikiIDs = append(shikiIDs, s.ShikiID)
+		}
+	}
+
+	now := time.Now()
+	dueIDs := sched.due(shikiIDs, now)
+
+	if len(dueIDs) == 0 {
+		return
+	}
+
+	logger.Info("Checking animes due for new episodes",
+		"due", len(dueIDs),
+		"tracked", len(shikiIDs))
+
+	sliceAnime, err := n.source.SearchAnimeByShikiIDs(ctx, dueIDs)
+
+	if err != nil {
+		logger.Error("Error searching animes by shiki IDs, skipping cycle",
+			"Shiki IDs", len(dueIDs),
+			"error", err)
+
+		return
+	}
+
+	if n.db != nil {
+		animecache.Put(ctx, n.db, sliceAnime)
+	}
+
+	mapAnime := make(map[string]animes.Anime, len(sliceAnime))
+
+	for _, a := range sliceAnime {
+		mapAnime[a.ShikiID] = a
+		sched.update(a, now)
+	}
+
+	isDue := make(map[string]bool, len(dueIDs))
+
+	for _, id := range dueIDs {
+		isDue[id] = true
+
+		if _, ok := mapAnime[id]; !ok {
+			// Unknown to the catalog, don't ask again every minute
+			sched.update(animes.Anime{ShikiID: id}, now)
+		}
+	}
+
+	for _, s := range sliceSubscribers {
+		if !isDue[s.ShikiID] {
+			continue
+		}
+
+		a, ok := mapAnime[s.ShikiID]
+
+		if !ok {
+			logger.Error("Error: no anime found",
+				"Shiki ID", s.ShikiID)
+			continue
+		}
+
+		chatID := s.ChatID
+
+		if a.Status == "released" {
+			logger.Info("Anime status RELEASED!", "Anime name", a.English)
+
+			err = store.Remove(ctx, s.ID)
+
+			if err != nil {
+				logger.Error("Error removing subscription",
+					"Telegram ID", s.TelegramID,
+					"Shiki ID", s.ShikiID)
+			} else {
+				cards.Send(bot, int64(chatID), a, releasedHeader,
+					cards.NotificationKeyboard(a, botUserName, false))
+			}
+		} else if a.EpisodesAired > s.LastEpisodeNotified {
+			logger.Info("New Episode!",
+				"Anime name", a.English,
+				"Episode", a.EpisodesAired)
+
+			cards.Send(bot, int64(chatID), a,
+				fmt.Sprintf("New Episode %d!", a.EpisodesAired),
+				cards.NotificationKeyboard(a, botUserName, true))
+
+			store.SetLastEpisode(ctx, s.ID, a.EpisodesAired)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package notifier
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+
+	"smOwd/animes"
+	"smOwd/animes/shikifake"
+	"smOwd/subscriptions"
+	"smOwd/tgbot/tgfake"
+	"smOwd/users"
+)
+
+func TestCheckNotifiesSubscribers(t *testing.T) {
+	ctx := context.Background()
+
+	shiki := shikifake.New([]animes.Anime{
+		{ShikiID: "101", English: "Frieren Alpha", Status: "ongoing",
+			Episodes: 12, EpisodesAired: 3,
+			URL: "https://shikimori.one/animes/101"},
+	})
+	shikiTS := shiki.Start()
+	defer shikiTS.Close()
+
+	fake := tgfake.New()
+	ts := fake.Start()
+	defer ts.Close()
+
+	api, err := tgfake.NewBotAPI(ts, "token")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	userStore := users.NewMemoryStore()
+	subscriptionStore := subscriptions.NewMemoryStore(userStore)
+
+	// One user subscribed with notifications on, one with them off
+	for _, u := range []users.User{
+		{TelegramID: 7, ChatID: 42, FirstName: "On", Enabled: true},
+		{TelegramID: 8, ChatID: 43, FirstName: "Off", Enabled: false},
+	} {
+		if _, err := userStore.Add(ctx, &u); err != nil {
+			t.Fatal(err)
+		}
+
+		_, err := subscriptionStore.Add(ctx, subscriptions.Subscription{
+			TelegramID:          u.TelegramID,
+			ShikiID:             "101",
+			LastEpisodeNotified: 3,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	n := New(nil, subscriptionStore, api, animes.NewShikimori(shikiTS.URL))
+
+	// check runs a cycle as if the anime were due again
+	check := func() []tgfake.Call {
+		t.Helper()
+
+		before := len(fake.CallsTo("sendMessage"))
+
+		n.sched = newScheduler()
+		n.Check(ctx)
+
+		return fake.CallsTo("sendMessage")[before:]
+	}
+
+	if sent := check(); len(sent) != 0 {
+		t.Fatalf("notified %d times with nothing new", len(sent))
+	}
+
+	shiki.UpdateAnime("101", func(a *animes.Anime) { a.EpisodesAired = 4 })
+
+	sent := check()
+	if len(sent) != 1 || sent[0].ChatID() != 42 ||
+		!strings.Contains(sent[0].Text(), "New Episode 4!") {
+		t.Fatalf("sent %v, want New Episode 4! to chat 42 only", sent)
+	}
+
+	if got := buttonURLs(sent[0]); !slices.Equal(got, []string{
+		"https://t.me/fake_bot?start=unsub_101",
+		"https://shikimori.one/animes/101",
+	}) {
+		t.Errorf("episode card buttons %v, want Unsubscribe and Shikimori", got)
+	}
+
+	if s := subscriptionStore.Find(ctx, 7, "101"); s == nil ||
+		s.LastEpisodeNotified != 4 {
+		t.Errorf("subscription %+v, want episode 4 notified", s)
+	}
+
+	if sent := check(); len(sent) != 0 {
+		t.Fatalf("notified episode 4 again: %v", sent)
+	}
+
+	shiki.UpdateAnime("101", func(a *animes.Anime) {
+		a.Status = "released"
+		a.EpisodesAired = 12
+	})
+
+	sent = check()
+	if len(sent) != 1 || !strings.Contains(sent[0].Text(), releasedHeader) {
+		t.Fatalf("sent %v, want the released card", sent)
+	}
+
+	if got := buttonURLs(sent[0]); !slices.Equal(got, []string{
+		"https://shikimori.one/animes/101",
+	}) {
+		t.Errorf("released card buttons %v, want Shikimori only", got)
+	}
+
+	if s := subscriptionStore.Find(ctx, 7, "101"); s != nil {
+		t.Errorf("still subscribed to a released anime: %+v", s)
+	}
+}
+
+func buttonURLs(call tgfake.Call) []string {
+	var urls []string
+
+	if keyboard := call.Keyboard(); keyboard != nil {
+		for _, row := range keyboard.InlineKeyboard {
+			for _, button := range row {
+				if button.URL != nil {
+					urls = append(urls, *button.URL)
+				}
+			}
+		}
+	}
+	return urls
+}
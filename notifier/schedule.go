@@ -0,0 +1,101 @@
+package notifier
+
+import (
+	"sync"
+	"time"
+
+	"smOwd/animes"
+)
+
+const (
+	// checkInterval is how often the notifier looks for due animes.
+	checkInterval = time.Minute
+
+	// airedGrace is how long after nextEpisodeAt Shikimori usually needs to
+	// bump episodesAired.
+	airedGrace = 10 * time.Minute
+
+	// recheckBase and recheckMax bound the backoff used while an episode
+	// that should have aired hasn't shown up yet.
+	recheckBase = 15 * time.Minute
+	recheckMax  = 6 * time.Hour
+
+	// unknownScheduleInterval is the slow cadence for animes without a
+	// nextEpisodeAt, and the longest any anime goes unchecked.
+	unknownScheduleInterval = 6 * time.Hour
+)
+
+type scheduleEntry struct {
+	due           time.Time
+	episodesAired int
+	attempts      int
+}
+
+// scheduler decides when each anime needs to be looked up again. Animes it
+// hasn't seen yet are due immediately.
+type scheduler struct {
+	mu      sync.Mutex
+	entries map[string]*scheduleEntry
+}
+
+func newScheduler() *scheduler {
+	return &scheduler{entries: make(map[string]*scheduleEntry)}
+}
+
+// due returns the ids among shikiIDs that should be checked at now, and
+// forgets ids nobody is subscribed to anymore.
+func (s *scheduler) due(shikiIDs []string, now time.Time) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var result []string
+	tracked := make(map[string]bool, len(shikiIDs))
+
+	for _, id := range shikiIDs {
+		tracked[id] = true
+
+		e, ok := s.entries[id]
+		if !ok || !now.Before(e.due) {
+			result = append(result, id)
+		}
+	}
+
+	for id := range s.entries {
+		if !tracked[id] {
+			delete(s.entries, id)
+		}
+	}
+
+	return result
+}
+
+// update schedules the next check of a after looking it up at now.
+func (s *scheduler) update(a animes.Anime, now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.entries[a.ShikiID]
+	if !ok || a.EpisodesAired != e.episodesAired {
+		e = &scheduleEntry{episodesAired: a.EpisodesAired}
+		s.entries[a.ShikiID] = e
+	}
+
+	if a.NextEpisodeAt != nil && a.NextEpisodeAt.After(now) {
+		e.attempts = 0
+		e.due = a.NextEpisodeAt.Add(airedGrace)
+	} else if a.NextEpisodeAt != nil {
+		// The episode should be out but episodesAired hasn't moved yet
+		delay := recheckBase << e.attempts
+		if delay <= 0 || delay > recheckMax {
+			delay = recheckMax
+		}
+		e.attempts++
+		e.due = now.Add(delay)
+	} else {
+		e.due = now.Add(unknownScheduleInterval)
+	}
+
+	if latest := now.Add(unknownScheduleInterval); e.due.After(latest) {
+		e.due = latest
+	}
+}
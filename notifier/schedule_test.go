@@ -0,0 +1,128 @@
+package notifier
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"smOwd/animes"
+)
+
+var scheduleStart = time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC)
+
+func TestSchedulerUpdate(t *testing.T) {
+	now := scheduleStart
+	soon := now.Add(2 * time.Hour)
+	later := now.Add(3 * 24 * time.Hour)
+	past := now.Add(-time.Hour)
+
+	tests := []struct {
+		name  string
+		anime animes.Anime
+		want  time.Time
+	}{
+		{"next episode soon", animes.Anime{NextEpisodeAt: &soon},
+			soon.Add(airedGrace)},
+		{"next episode in days", animes.Anime{NextEpisodeAt: &later},
+			now.Add(unknownScheduleInterval)},
+		{"episode overdue", animes.Anime{NextEpisodeAt: &past},
+			now.Add(recheckBase)},
+		{"no schedule", animes.Anime{},
+			now.Add(unknownScheduleInterval)},
+	}
+
+	for _, tt := range tests {
+		s := newScheduler()
+		tt.anime.ShikiID = "1"
+
+		s.update(tt.anime, now)
+
+		if got := s.entries["1"].due; !got.Equal(tt.want) {
+			t.Errorf("%s: due %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSchedulerOverdueBackoff(t *testing.T) {
+	s := newScheduler()
+	now := scheduleStart
+	aired := now.Add(-time.Minute)
+	a := animes.Anime{ShikiID: "1", EpisodesAired: 3, NextEpisodeAt: &aired}
+
+	want := []time.Duration{
+		15 * time.Minute,
+		30 * time.Minute,
+		time.Hour,
+		2 * time.Hour,
+		4 * time.Hour,
+		6 * time.Hour, // capped at recheckMax
+		6 * time.Hour,
+	}
+
+	for i, delay := range want {
+		s.update(a, now)
+
+		if got := s.entries["1"].due.Sub(now); got != delay {
+			t.Fatalf("check %d: next in %v, want %v", i+1, got, delay)
+		}
+
+		now = s.entries["1"].due
+	}
+
+	// Plenty of attempts later the shift overflows, still capped
+	s.entries["1"].attempts = 70
+	s.update(a, now)
+
+	if got := s.entries["1"].due.Sub(now); got != recheckMax {
+		t.Errorf("after 70 attempts next in %v, want %v", got, recheckMax)
+	}
+
+	// The episode shows up: the backoff starts over
+	next := now.Add(7 * 24 * time.Hour)
+	a.EpisodesAired = 4
+	a.NextEpisodeAt = &next
+	s.update(a, now)
+
+	if e := s.entries["1"]; e.attempts != 0 || e.episodesAired != 4 {
+		t.Errorf("after new episode attempts %d, episodes %d, want 0, 4",
+			e.attempts, e.episodesAired)
+	}
+}
+
+func TestSchedulerDue(t *testing.T) {
+	s := newScheduler()
+	now := scheduleStart
+	soon := now.Add(time.Hour)
+
+	if got := s.due([]string{"1", "2"}, now); !slices.Equal(got, []string{"1", "2"}) {
+		t.Fatalf("unseen animes due %v, want both", got)
+	}
+
+	s.update(animes.Anime{ShikiID: "1", NextEpisodeAt: &soon}, now)
+	s.update(animes.Anime{ShikiID: "2"}, now)
+
+	if got := s.due([]string{"1", "2"}, now); len(got) != 0 {
+		t.Errorf("just checked animes due %v, want none", got)
+	}
+
+	at := soon.Add(airedGrace)
+
+	if got := s.due([]string{"1", "2"}, at.Add(-time.Second)); len(got) != 0 {
+		t.Errorf("due %v a second early, want none", got)
+	}
+
+	if got := s.due([]string{"1", "2"}, at); !slices.Equal(got, []string{"1"}) {
+		t.Errorf("due %v at nextEpisodeAt+grace, want [1]", got)
+	}
+
+	if got := s.due([]string{"1", "2"}, now.Add(unknownScheduleInterval)); !slices.Equal(got, []string{"1", "2"}) {
+		t.Errorf("due %v after the slow interval, want both", got)
+	}
+
+	// Unsubscribed animes are forgotten
+	s.due([]string{"2"}, now)
+
+	if _, ok := s.entries["1"]; ok {
+		t.Error("entry for untracked anime kept")
+	}
+}
@@ -0,0 +1,221 @@
+package sessions
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"smOwd/logs"
+	"smOwd/pql"
+)
+
+const tableName = "sessions"
+
+// DefaultTTL is how long an idle session is kept.
+const DefaultTTL = 24 * time.Hour
+
+// cleanupInterval is how often RunCleanup deletes expired sessions.
+const cleanupInterval = time.Hour
+
+// Session is the persisted state of a user's conversation with the bot:
+// the mode it is in and what the buttons on screen refer to.
+type Session struct {
+	UserID          int      `json:"-"`
+	Mode            int      `json:"mode"`
+	AnimeIDs        []string `json:"animeIds,omitempty"`
+	SubscriptionIDs []int    `json:"subscriptionIds,omitempty"`
+	SearchQuery     string   `json:"searchQuery,omitempty"`
+	SearchPage      int      `json:"searchPage,omitempty"`
+	LastMessageID   int      `json:"lastMessageId,omitempty"`
+	Selected        []string `json:"selected,omitempty"`
+	Nonce           string   `json:"nonce,omitempty"`
+
+	// UpdatedAt is when the user last did something in this session
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// SessionStore keeps sessions between updates and across restarts. Load
+// returns nil without error when the user has no session or it expired.
+type SessionStore interface {
+	Load(ctx context.Context, userID int) (*Session, error)
+	Save(ctx context.Context, s *Session) error
+	Delete(ctx context.Context, userID int) error
+}
+
+func CheckTable(ctx context.Context, db *sql.DB) (bool, error) {
+	return pql.CheckTable(ctx, db, tableName)
+}
+
+func CreateTable(ctx context.Context, db *sql.DB) error {
+	columns := `
+		user_id INT PRIMARY KEY REFERENCES users (id) ON DELETE CASCADE,
+		data JSONB NOT NULL,
+		expires_at TIMESTAMPTZ NOT NULL
+	`
+	return pql.CreateTable(ctx, db, tableName, columns,
+		"idx_sessions_expires_at", "expires_at")
+}
+
+// PostgresStore is a SessionStore backed by the sessions table.
+type PostgresStore struct {
+	db  *sql.DB
+	ttl time.Duration
+}
+
+func NewPostgresStore(db *sql.DB, ttl time.Duration) *PostgresStore {
+	return &PostgresStore{db: db, ttl: ttl}
+}
+
+func (p *PostgresStore) Load(ctx context.Context, userID int) (*Session, error) {
+	logger := logs.DefaultFromCtx(ctx)
+
+	query := `
+		SELECT data
+		FROM sessions
+		WHERE user_id = $1
+		AND expires_at > NOW();
+	`
+
+	var data []byte
+
+	err := p.db.QueryRowContext(ctx, query, userID).Scan(&data)
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		logger.Error("Failed to load session", "User ID", userID, "error", err)
+		return nil, err
+	}
+
+	var s Session
+
+	if err := json.Unmarshal(data, &s); err != nil {
+		logger.Error("Failed to unmarshall session", "User ID", userID, "error", err)
+		return nil, err
+	}
+
+	s.UserID = userID
+
+	return &s, nil
+}
+
+func (p *PostgresStore) Save(ctx context.Context, s *Session) error {
+	logger := logs.DefaultFromCtx(ctx)
+
+	data, err := json.Marshal(s)
+
+	if err != nil {
+		logger.Error("Failed to marshall session", "User ID", s.UserID, "error", err)
+		return err
+	}
+
+	query := `
+		INSERT INTO sessions (user_id, data, expires_at)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (user_id) DO UPDATE SET
+			data = EXCLUDED.data,
+			expires_at = EXCLUDED.expires_at;
+	`
+
+	_, err = p.db.ExecContext(ctx, query, s.UserID, string(data),
+		time.Now().Add(p.ttl))
+
+	if err != nil {
+		logger.Error("Failed to save session", "User ID", s.UserID, "error", err)
+	}
+
+	return err
+}
+
+func (p *PostgresStore) Delete(ctx context.Context, userID int) error {
+	_, err := p.db.ExecContext(ctx, `DELETE FROM sessions WHERE user_id = $1;`,
+		userID)
+	return err
+}
+
+// RemoveExpired deletes sessions past their expiry.
+func (p *PostgresStore) RemoveExpired(ctx context.Context) error {
+	_, err := p.db.ExecContext(ctx, `DELETE FROM sessions WHERE expires_at <= NOW();`)
+	return err
+}
+
+// RunCleanup removes expired sessions every cleanupInterval until ctx is
+// done. Load already ignores them, this only keeps the table small.
+func (p *PostgresStore) RunCleanup(ctx context.Context) {
+	logger := logs.DefaultFromCtx(ctx)
+
+	ticker := time.NewTicker(cleanupInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := p.RemoveExpired(ctx); err != nil && ctx.Err() == nil {
+			logger.Error("Failed to remove expired sessions", "error", err)
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// MemoryStore is a SessionStore kept in process memory, for tests and for
+// running without a database.
+type MemoryStore struct {
+	mu       sync.Mutex
+	ttl      time.Duration
+	sessions map[int]memoryEntry
+}
+
+type memoryEntry struct {
+	session   Session
+	expiresAt time.Time
+}
+
+func NewMemoryStore(ttl time.Duration) *MemoryStore {
+	return &MemoryStore{ttl: ttl, sessions: make(map[int]memoryEntry)}
+}
+
+func (m *MemoryStore) Load(ctx context.Context, userID int) (*Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e, ok := m.sessions[userID]
+	if !ok || !time.Now().Before(e.expiresAt) {
+		delete(m.sessions, userID)
+		return nil, nil
+	}
+
+	s := e.session
+	s.AnimeIDs = append([]string(nil), s.AnimeIDs...)
+	s.SubscriptionIDs = append([]int(nil), s.SubscriptionIDs...)
+	s.Selected = append([]string(nil), s.Selected...)
+
+	return &s, nil
+}
+
+func (m *MemoryStore) Save(ctx context.Context, s *Session) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e := memoryEntry{session: *s, expiresAt: time.Now().Add(m.ttl)}
+	e.session.AnimeIDs = append([]string(nil), s.AnimeIDs...)
+	e.session.SubscriptionIDs = append([]int(nil), s.SubscriptionIDs...)
+	e.session.Selected = append([]string(nil), s.Selected...)
+
+	m.sessions[s.UserID] = e
+
+	return nil
+}
+
+func (m *MemoryStore) Delete(ctx context.Context, userID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.sessions, userID)
+
+	return nil
+}
@@ -0,0 +1,157 @@
+package subscriptions
+
+import (
+	"context"
+	"database/sql"
+	"slices"
+	"sync"
+
+	"smOwd/users"
+)
+
+// SubscriptionStore is what the bot and the notifier need of the
+// subscriptions table, so both can run against memory in tests.
+type SubscriptionStore interface {
+	Add(ctx context.Context, s Subscription) (int, error)
+	Find(ctx context.Context, telegramID int, shikiID string) *Subscription
+	FindAll(ctx context.Context, telegramID int) []Subscription
+	SelectAllEnabled(ctx context.Context) []Subscriber
+	SetLastEpisode(ctx context.Context, id int, n int) error
+	Remove(ctx context.Context, id int) error
+}
+
+// PostgresStore is a SubscriptionStore backed by the subscriptions table.
+type PostgresStore struct {
+	db *sql.DB
+}
+
+func NewPostgresStore(db *sql.DB) *PostgresStore {
+	return &PostgresStore{db: db}
+}
+
+func (p *PostgresStore) Add(ctx context.Context, s Subscription) (int, error) {
+	return Add(ctx, p.db, s)
+}
+
+func (p *PostgresStore) Find(ctx context.Context, telegramID int,
+	shikiID string) *Subscription {
+	return Find(ctx, p.db, telegramID, shikiID)
+}
+
+func (p *PostgresStore) FindAll(ctx context.Context, telegramID int) []Subscription {
+	return FindAll(ctx, p.db, telegramID)
+}
+
+func (p *PostgresStore) SelectAllEnabled(ctx context.Context) []Subscriber {
+	return SelectAllEnabled(ctx, p.db)
+}
+
+func (p *PostgresStore) SetLastEpisode(ctx context.Context, id int, n int) error {
+	return SetLastEpisode(ctx, p.db, id, n)
+}
+
+func (p *PostgresStore) Remove(ctx context.Context, id int) error {
+	return Remove(ctx, p.db, id)
+}
+
+// MemoryStore is a SubscriptionStore kept in process memory, for tests and
+// for running without a database. It looks owners up in userStore the way
+// the table joins users.
+type MemoryStore struct {
+	mu            sync.Mutex
+	userStore     users.UserStore
+	subscriptions []Subscription
+	nextID        int
+}
+
+func NewMemoryStore(userStore users.UserStore) *MemoryStore {
+	return &MemoryStore{userStore: userStore, nextID: 1}
+}
+
+// Add returns -1 without error for a subscription already there, like the
+// table's ON CONFLICT DO NOTHING.
+func (m *MemoryStore) Add(ctx context.Context, s Subscription) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, existing := range m.subscriptions {
+		if existing.TelegramID == s.TelegramID && existing.ShikiID == s.ShikiID {
+			return -1, nil
+		}
+	}
+
+	s.ID = m.nextID
+	s.Anime = nil
+	m.nextID++
+
+	m.subscriptions = append(m.subscriptions, s)
+
+	return s.ID, nil
+}
+
+func (m *MemoryStore) Find(ctx context.Context, telegramID int,
+	shikiID string) *Subscription {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, s := range m.subscriptions {
+		if s.TelegramID == telegramID && s.ShikiID == shikiID {
+			return &s
+		}
+	}
+	return nil
+}
+
+func (m *MemoryStore) FindAll(ctx context.Context, telegramID int) []Subscription {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var result []Subscription
+
+	for _, s := range m.subscriptions {
+		if s.TelegramID == telegramID {
+			result = append(result, s)
+		}
+	}
+	return result
+}
+
+func (m *MemoryStore) SelectAllEnabled(ctx context.Context) []Subscriber {
+	m.mu.Lock()
+	sliceSubscriptions := slices.Clone(m.subscriptions)
+	m.mu.Unlock()
+
+	var subscribers []Subscriber
+
+	for _, s := range sliceSubscriptions {
+		u := m.userStore.FindByTelegramID(ctx, s.TelegramID)
+		if u == nil || !u.Enabled {
+			continue
+		}
+
+		subscribers = append(subscribers, Subscriber{Subscription: s, ChatID: u.ChatID})
+	}
+	return subscribers
+}
+
+func (m *MemoryStore) SetLastEpisode(ctx context.Context, id int, n int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := range m.subscriptions {
+		if m.subscriptions[i].ID == id {
+			m.subscriptions[i].LastEpisodeNotified = n
+		}
+	}
+	return nil
+}
+
+func (m *MemoryStore) Remove(ctx context.Context, id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.subscriptions = slices.DeleteFunc(m.subscriptions,
+		func(s Subscription) bool { return s.ID == id })
+
+	return nil
+}
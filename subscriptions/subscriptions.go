@@ -75,6 +75,7 @@ func Add(ctx context.Context, db *sql.DB, s Subscription) (int, error) {
         INSERT INTO subscriptions (telegram_id, shiki_id, last_episode_notified)
         VALUES ($1, $2, $3)
         ON CONFLICT (telegram_id, shiki_id) DO NOTHING
+        RETURNING id
     `
 
 	var id int
@@ -95,7 +96,7 @@ func Add(ctx context.Context, db *sql.DB, s Subscription) (int, error) {
 	}
 
 	// Log successful insertion
-	logger.Info(fmt.Sprintf("Subscription added for user %d and anime %d", s.TelegramID, s.ShikiID))
+	logger.Info(fmt.Sprintf("Subscription added for user %d and anime %s", s.TelegramID, s.ShikiID))
 	return id, nil
 }
 
@@ -228,6 +229,62 @@ func SelectAll(ctx context.Context, db *sql.DB) []Subscription {
 	return subscriptions
 }
 
+// Subscriber is a subscription joined with the chat of the user owning it.
+type Subscriber struct {
+	Subscription
+	ChatID int
+}
+
+// SelectAllEnabled returns every subscription of users with notifications
+// enabled, together with their chat, in a single query.
+func SelectAllEnabled(ctx context.Context, db *sql.DB) []Subscriber {
+	logger := logs.DefaultFromCtx(ctx)
+
+	query := fmt.Sprintf(`
+		SELECT s.id, s.telegram_id, s.shiki_id, s.last_episode_notified, u.chat_id
+		FROM %s s
+		JOIN users u ON u.telegram_id = s.telegram_id
+		WHERE u.enabled;
+	`, tableName)
+
+	var subscribers []Subscriber
+
+	rows, err := db.QueryContext(ctx, query)
+
+	if err != nil {
+		logger.Error("Error searching subscribers",
+			"error", err)
+
+		return nil
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var s Subscriber
+
+		err := rows.Scan(
+			&s.ID,
+			&s.TelegramID,
+			&s.ShikiID,
+			&s.LastEpisodeNotified,
+			&s.ChatID,
+		)
+
+		if err != nil {
+			logger.Error("Error processing row", "error", err)
+			return nil
+		}
+
+		subscribers = append(subscribers, s)
+	}
+
+	// The notifier asks every minute, only worth seeing when debugging
+	logger.Debug("Subscribers retrieved successfully", "count", len(subscribers))
+
+	return subscribers
+}
+
 func SetLastEpisode(ctx context.Context, db *sql.DB, id int, n int) error {
 	return pql.SetField(ctx, db, tableName, "id", id, "last_episode_notified", n)
 }
@@ -0,0 +1,117 @@
+package tgbot
+
+import (
+	"errors"
+	"math/rand/v2"
+	"strconv"
+	"strings"
+)
+
+// The callback data of every inline button is a callbackData encoded as
+//
+//	<version>:<action>:<id>:<nonce>
+//
+// e.g. "1:tick:52991:k3f9a". id is what the action works on, a shiki_id, a
+// subscription ID or a page, and may be empty. nonce is the session's nonce
+// when the button was made, which changes with every state entered, so
+// buttons left over from an earlier flow or session are told apart.
+
+// callbackVersion is bumped whenever the encoding or the meaning of an
+// action changes, so buttons sent by an older bot are rejected as stale.
+const callbackVersion = 1
+
+// callbackDataLimit is Telegram's limit on callback data, in bytes.
+const callbackDataLimit = 64
+
+type callbackAction string
+
+const (
+	actionEnable        callbackAction = "on"
+	actionDisable       callbackAction = "off"
+	actionSubscriptions callbackAction = "subs"
+	actionRemove        callbackAction = "rm"
+	actionSearch        callbackAction = "find"
+	actionCancel        callbackAction = "cancel"
+	actionConfirm       callbackAction = "ok"
+	actionToggle        callbackAction = "tick"
+	actionPage          callbackAction = "page"
+	actionSubscribe     callbackAction = "sub"
+)
+
+type callbackData struct {
+	action callbackAction
+	id     string
+	nonce  string
+}
+
+var errBadCallback = errors.New("malformed callback data")
+
+func (d callbackData) encode() string {
+	return strings.Join([]string{
+		strconv.Itoa(callbackVersion),
+		string(d.action),
+		d.id,
+		d.nonce,
+	}, ":")
+}
+
+// intID is the id of a button for a subscription or a page.
+func (d callbackData) intID() (int, error) {
+	return strconv.Atoi(d.id)
+}
+
+func decodeCallback(data string) (callbackData, error) {
+	if len(data) > callbackDataLimit {
+		return callbackData{}, errBadCallback
+	}
+
+	parts := strings.Split(data, ":")
+
+	if len(parts) != 4 || parts[1] == "" {
+		return callbackData{}, errBadCallback
+	}
+
+	version, err := strconv.Atoi(parts[0])
+
+	if err != nil {
+		return callbackData{}, errBadCallback
+	} else if version != callbackVersion {
+		return callbackData{}, errors.New("callback data of version " + parts[0])
+	}
+
+	return callbackData{
+		action: callbackAction(parts[1]),
+		id:     parts[2],
+		nonce:  parts[3],
+	}, nil
+}
+
+// callback encodes the data of a button for action on id, made now.
+func (session *sessionData) callback(action callbackAction, id string) string {
+	return callbackData{action: action, id: id, nonce: session.nonce}.encode()
+}
+
+// renewNonce makes the buttons shown so far stale.
+func (session *sessionData) renewNonce() {
+	session.nonce = strconv.FormatUint(uint64(rand.Uint32()), 36)
+}
+
+// readCallback decodes the pressed button into c.callback, and reports
+// whether it is a live button on the chat's screen.
+func (c *conversation) readCallback() bool {
+	data, err := decodeCallback(c.update.CallbackQuery.Data)
+
+	if err != nil {
+		c.logger.Warn("Bad callback data",
+			"data", c.update.CallbackQuery.Data,
+			"error", err)
+
+		return false
+	} else if data.nonce != c.session.nonce || !c.fromScreen() {
+		return false
+	}
+
+	c.callback = data
+
+	return true
+}
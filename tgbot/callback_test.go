@@ -0,0 +1,85 @@
+package tgbot
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCallbackRoundTrip(t *testing.T) {
+	tests := []callbackData{
+		{action: actionToggle, id: "52991", nonce: "k3f9a"},
+		{action: actionPage, id: "12", nonce: "1z141z3"},
+		{action: actionCancel, nonce: "abc"},
+		{action: actionConfirm},
+	}
+
+	for _, want := range tests {
+		data := want.encode()
+
+		if len(data) > callbackDataLimit {
+			t.Errorf("%q is over %d bytes", data, callbackDataLimit)
+		}
+
+		got, err := decodeCallback(data)
+
+		if err != nil || got != want {
+			t.Errorf("decodeCallback(%q) = %+v, %v, want %+v", data, got, err, want)
+		}
+	}
+}
+
+func TestCallbackFitsLimit(t *testing.T) {
+	session := &sessionData{}
+
+	for range 100 {
+		session.renewNonce()
+
+		// The longest ids in use: shiki_ids, subscription IDs and pages
+		data := session.callback(actionSubscriptions, "2147483647")
+
+		if len(data) > callbackDataLimit {
+			t.Fatalf("%q is over %d bytes", data, callbackDataLimit)
+		}
+	}
+}
+
+func TestDecodeCallbackRejects(t *testing.T) {
+	tests := []string{
+		"",
+		"search",
+		"3",
+		"cancel",
+		"1:tick:52991",
+		"1:tick:52991:abc:extra",
+		"1::52991:abc",
+		"x:tick:52991:abc",
+		"0:tick:52991:abc",
+		"2:tick:52991:abc",
+		"1:tick:" + strings.Repeat("9", 60) + ":abc",
+	}
+
+	for _, data := range tests {
+		if got, err := decodeCallback(data); err == nil {
+			t.Errorf("decodeCallback(%q) = %+v, want an error", data, got)
+		}
+	}
+}
+
+func TestRenewNonce(t *testing.T) {
+	session := &sessionData{}
+	seen := make(map[string]bool)
+
+	for range 100 {
+		session.renewNonce()
+
+		if session.nonce == "" || strings.Contains(session.nonce, ":") {
+			t.Fatalf("bad nonce %q", session.nonce)
+		}
+
+		seen[session.nonce] = true
+	}
+
+	if len(seen) < 99 {
+		t.Errorf("%d distinct nonces in 100", len(seen))
+	}
+}
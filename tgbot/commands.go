@@ -0,0 +1,155 @@
+package tgbot
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+	"strings"
+
+	"smOwd/logs"
+
+	"github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+// command is a slash command. Commands work from any state: whatever flow
+// the user was in is abandoned first.
+type command struct {
+	name        string
+	description string
+	run         func(c *conversation, args string)
+}
+
+// commands are listed in this order in the Telegram client menu and /help.
+// They are set in init because runHelp refers back to them.
+var commands []command
+
+func init() {
+	commands = []command{
+		{"start", "Show the main menu", runStart},
+		{"search", "Search anime by title: /search frieren", runSearch},
+		{"list", "Show your subscriptions", runList},
+		{"unsubscribe", "Remove subscriptions", runUnsubscribe},
+		{"settings", "Turn notifications on or off", runSettings},
+		{"help", "List the commands", runHelp},
+		{"cancel", "Stop what you are doing", runCancel},
+	}
+}
+
+// runCommand runs the command the update's message starts with, if any, and
+// reports whether it did.
+func (c *conversation) runCommand() bool {
+	msg := c.update.Message
+
+	if msg == nil || !msg.IsCommand() {
+		return false
+	}
+
+	name := strings.ToLower(msg.Command())
+	args := strings.TrimSpace(msg.CommandArguments())
+
+	for _, cmd := range commands {
+		if cmd.name == name {
+			c.logger.Info("Command", "command", name, "tgname", c.user.UserName)
+
+			c.interrupt()
+			cmd.run(c, args)
+			return true
+		}
+	}
+
+	c.send("Unknown command /" + name + ", see /help")
+	return true
+}
+
+// runStart shows the menu, or handles a deep link such as
+// https://t.me/<bot>?start=sub_52991.
+func runStart(c *conversation, args string) {
+	if args != "" && c.runStartPayload(args) {
+		return
+	}
+
+	c.send("Started!")
+	c.sendMenu()
+}
+
+func runSearch(c *conversation, args string) {
+	if args == "" {
+		c.transition(states[handleUpdateModeBasic], handleUpdateModeSearch)
+		return
+	}
+
+	c.session.handleUpdateModeField = handleUpdateModeSearch
+	c.text = args
+	c.handleIn(states[handleUpdateModeSearch])
+}
+
+func runList(c *conversation, args string) {
+	showSubscriptions(c)
+	c.sendMenu()
+}
+
+func runUnsubscribe(c *conversation, args string) {
+	if next := startRemove(c); next != handleUpdateModeBasic {
+		c.transition(states[handleUpdateModeBasic], next)
+	}
+}
+
+func runSettings(c *conversation, args string) {
+	text := "Notifications are off"
+
+	if c.user.Enabled {
+		text = "Notifications are on"
+	}
+
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+		notificationsButton(c.session, c.user.Enabled)))
+
+	c.reply(text, &keyboard)
+}
+
+func runHelp(c *conversation, args string) {
+	c.send(helpText())
+}
+
+func runCancel(c *conversation, args string) {
+	c.send("Cancelled")
+	c.sendMenu()
+}
+
+func helpText() string {
+	text := "Commands:\n\n"
+
+	for _, cmd := range commands {
+		text += "/" + cmd.name + " - " + cmd.description + "\n"
+	}
+
+	return text
+}
+
+// registerCommands shows the commands in the Telegram client menu.
+func registerCommands(ctx context.Context, bot *tgbotapi.BotAPI) {
+	logger := logs.DefaultFromCtx(ctx)
+
+	type botCommand struct {
+		Command     string `json:"command"`
+		Description string `json:"description"`
+	}
+
+	var list []botCommand
+
+	for _, cmd := range commands {
+		list = append(list, botCommand{cmd.name, cmd.description})
+	}
+
+	data, err := json.Marshal(list)
+	if err != nil {
+		logger.Error("Failed to marshall commands", "error", err)
+		return
+	}
+
+	_, err = bot.MakeRequest("setMyCommands", url.Values{"commands": {string(data)}})
+
+	if err != nil {
+		logger.Warn("Failed to register commands", "error", err)
+	}
+}
@@ -0,0 +1,163 @@
+package tgbot
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"smOwd/animes"
+	"smOwd/animes/shikifake"
+	"smOwd/sessions"
+	"smOwd/subscriptions"
+	"smOwd/tgbot/tgfake"
+	"smOwd/users"
+
+	"github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+const (
+	testChatID = 42
+	testUserID = 7
+)
+
+var testAnimes = []animes.Anime{
+	{ShikiID: "101", Name: "Frieren Alpha", English: "Frieren Alpha",
+		Status: "ongoing", Episodes: 12, EpisodesAired: 3},
+	{ShikiID: "102", Name: "Frieren Beta", English: "Frieren Beta",
+		Status: "ongoing", Episodes: 10, EpisodesAired: 5},
+	{ShikiID: "103", Name: "Frieren Gamma", English: "Frieren Gamma",
+		Status: "ongoing", Episodes: 12, EpisodesAired: 1},
+}
+
+// testBot is the bot running against tgfake, shikifake and memory stores.
+type testBot struct {
+	t             *testing.T
+	fake          *tgfake.Server
+	shiki         *shikifake.Server
+	users         *users.MemoryStore
+	subscriptions *subscriptions.MemoryStore
+}
+
+func startTestBot(t *testing.T, fixtures []animes.Anime) *testBot {
+	t.Setenv("TELEGRAM_MODE", "")
+	t.Setenv("UPDATE_WORKERS", "1")
+
+	b := &testBot{t: t, fake: tgfake.New(), shiki: shikifake.New(fixtures)}
+	b.users = users.NewMemoryStore()
+	b.subscriptions = subscriptions.NewMemoryStore(b.users)
+
+	ts := b.fake.Start()
+	t.Cleanup(ts.Close)
+
+	shikiTS := b.shiki.Start()
+	t.Cleanup(shikiTS.Close)
+
+	api, err := tgfake.NewBotAPI(ts, "token")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		StartBotAndHandleUpdates(ctx, api, b.users, b.subscriptions,
+			animes.NewShikimori(shikiTS.URL), sessions.NewMemoryStore(time.Hour))
+	}()
+
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+
+	return b
+}
+
+// waitFor waits for the nth call to method and returns it.
+func (b *testBot) waitFor(method string, n int) tgfake.Call {
+	b.t.Helper()
+
+	calls, ok := b.fake.WaitForCalls(method, n, 5*time.Second)
+	if !ok {
+		b.t.Fatalf("%d %s calls, want %d; calls: %v", len(calls), method, n,
+			b.fake.Calls())
+	}
+	return calls[n-1]
+}
+
+// button finds the button with action and id on keyboard.
+func (b *testBot) button(keyboard *tgbotapi.InlineKeyboardMarkup,
+	action callbackAction, id string) string {
+	b.t.Helper()
+
+	if keyboard != nil {
+		for _, row := range keyboard.InlineKeyboard {
+			for _, button := range row {
+				if button.CallbackData == nil {
+					continue
+				}
+
+				data, err := decodeCallback(*button.CallbackData)
+				if err == nil && data.action == action && data.id == id {
+					return *button.CallbackData
+				}
+			}
+		}
+	}
+
+	b.t.Fatalf("no %s:%s button on %v", action, id, keyboard)
+	return ""
+}
+
+func TestConversationSearchAndSubscribe(t *testing.T) {
+	b := startTestBot(t, testAnimes)
+
+	b.fake.SendMessage(testChatID, testUserID, "/search frieren")
+
+	results := b.waitFor("sendMessage", 1)
+	screen := results.SentMessageID
+
+	if !strings.Contains(results.Text(), "Frieren Gamma") {
+		t.Fatalf("results %q, want all three animes", results.Text())
+	}
+
+	// Tick 1 and 2, each press redraws the screen in place
+	keyboard := results.Keyboard()
+
+	for i, id := range []string{"101", "102"} {
+		b.fake.PressButton(testChatID, testUserID, screen,
+			b.button(keyboard, actionToggle, id))
+
+		edit := b.waitFor("editMessageText", i+1)
+		if edit.MessageID() != screen {
+			t.Fatalf("edited message %d, want the screen %d",
+				edit.MessageID(), screen)
+		}
+		keyboard = edit.Keyboard()
+	}
+
+	b.fake.PressButton(testChatID, testUserID, screen,
+		b.button(keyboard, actionConfirm, ""))
+
+	outcome := b.waitFor("editMessageText", 3).Text()
+
+	for _, title := range []string{"Frieren Alpha", "Frieren Beta"} {
+		if !strings.Contains(outcome, "You are now subscribed to "+title) {
+			t.Errorf("outcome %q, want a subscription to %s", outcome, title)
+		}
+	}
+
+	b.waitFor("answerCallbackQuery", 3)
+
+	var shikiIDs []string
+
+	for _, s := range b.subscriptions.FindAll(context.Background(), testUserID) {
+		shikiIDs = append(shikiIDs, s.ShikiID)
+	}
+
+	if strings.Join(shikiIDs, ",") != "101,102" {
+		t.Errorf("subscribed to %v, want [101 102]", shikiIDs)
+	}
+}
@@ -0,0 +1,89 @@
+package tgbot
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+
+	"smOwd/animes"
+	"smOwd/cards"
+)
+
+// shikiIDRe matches the id in a payload. Like in links, ids may carry a
+// letter prefix (sub_z52991), which the catalog doesn't know them by.
+var shikiIDRe = regexp.MustCompile(`^[a-z]?(\d+)$`)
+
+// runStartPayload handles the payload of a /start deep link and reports
+// whether it understood it. Payloads are made by cards.SubscribeLink and
+// cards.UnsubscribeLink.
+func (c *conversation) runStartPayload(payload string) bool {
+	if id, ok := strings.CutPrefix(payload, cards.UnsubscribePayloadPrefix); ok {
+		return c.runUnsubscribePayload(id)
+	}
+
+	id, ok := strings.CutPrefix(payload, cards.SubscribePayloadPrefix)
+	m := shikiIDRe.FindStringSubmatch(id)
+
+	if !ok || m == nil {
+		c.logger.Warn("Unknown start payload", "payload", payload)
+		return false
+	}
+
+	shikiID := m[1]
+
+	anime, err := c.catalog.GetAnimeDetails(c.ctx, shikiID)
+
+	if errors.Is(err, animes.ErrAnimeNotFound) {
+		c.send("Couldn't find that anime")
+		c.sendMenu()
+	} else if err != nil {
+		c.logger.Error("Error looking up deep link anime",
+			"Shiki ID", shikiID,
+			"error", err)
+
+		c.send(catalogErrorText(err))
+		c.sendMenu()
+	} else {
+		c.offer(*anime)
+	}
+
+	return true
+}
+
+// runUnsubscribePayload asks to confirm dropping the subscription the
+// Unsubscribe button of a notification points at.
+func (c *conversation) runUnsubscribePayload(id string) bool {
+	m := shikiIDRe.FindStringSubmatch(id)
+
+	if m == nil {
+		c.logger.Warn("Unknown start payload",
+			"payload", cards.UnsubscribePayloadPrefix+id)
+		return false
+	}
+
+	shikiID := m[1]
+
+	// Only the title is needed, a card without the details will do
+	anime := animes.Anime{ShikiID: shikiID, English: shikiID}
+
+	if found, err := c.catalog.GetAnimeDetails(c.ctx, shikiID); err == nil {
+		anime = *found
+	} else {
+		c.logger.Warn("Error looking up unsubscribe link anime",
+			"Shiki ID", shikiID,
+			"error", err)
+	}
+
+	s := c.subscriptionStore.Find(c.ctx, c.user.TelegramID, shikiID)
+
+	if s == nil {
+		c.send("You are not subscribed to " + anime.English)
+		c.sendMenu()
+		return true
+	}
+
+	s.Anime = &anime
+	c.confirmUnsubscribe(*s)
+
+	return true
+}
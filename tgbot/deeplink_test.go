@@ -0,0 +1,143 @@
+package tgbot
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"smOwd/animes"
+	"smOwd/animes/shikifake"
+	"smOwd/logs"
+	"smOwd/subscriptions"
+	"smOwd/tgbot/tgfake"
+	"smOwd/users"
+)
+
+func TestRunStartPayload(t *testing.T) {
+	catalog := shikifake.New([]animes.Anime{
+		{ShikiID: "52991", English: "Frieren", Status: "ongoing"},
+	})
+	cs := catalog.Start()
+	defer cs.Close()
+
+	tests := []struct {
+		payload string
+		want    bool
+		lookup  string
+	}{
+		{"sub_52991", true, "52991"},
+		{"sub_z52991", true, "52991"},
+		{"sub_", false, ""},
+		{"sub_zz52991", false, ""},
+		{"sub_52991x", false, ""},
+		{"52991", false, ""},
+	}
+
+	for _, tt := range tests {
+		fake := tgfake.New()
+		ts := fake.Start()
+
+		api, err := tgfake.NewBotAPI(ts, "token")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ctx := context.Background()
+		requests := len(catalog.Requests())
+
+		c := &conversation{
+			ctx:     ctx,
+			logger:  logs.DefaultFromCtx(ctx),
+			bot:     NewMessenger(api),
+			catalog: animes.NewShikimori(cs.URL),
+			user:    &users.User{},
+			chatID:  1,
+			session: &sessionData{handleUpdateModeField: handleUpdateModeBasic},
+		}
+
+		if got := c.runStartPayload(tt.payload); got != tt.want {
+			t.Errorf("runStartPayload(%q) = %v, want %v", tt.payload, got, tt.want)
+		}
+
+		sent := catalog.Requests()[requests:]
+
+		if tt.lookup == "" {
+			if len(sent) != 0 {
+				t.Errorf("%q looked up %v", tt.payload, sent)
+			}
+		} else if len(sent) != 1 || sent[0].Variables["ids"] != tt.lookup {
+			t.Errorf("%q looked up %v, want ids %s", tt.payload, sent, tt.lookup)
+		} else if c.session.handleUpdateModeField != handleUpdateModeOffer {
+			t.Errorf("%q left mode %v, want Offer", tt.payload,
+				c.session.handleUpdateModeField)
+		}
+
+		ts.Close()
+	}
+}
+
+func TestRunUnsubscribePayload(t *testing.T) {
+	b := startTestBot(t, testAnimes)
+	ctx := context.Background()
+
+	b.subscriptions.Add(ctx, subscriptions.Subscription{
+		TelegramID: testUserID,
+		ShikiID:    "101",
+	})
+
+	// A bad id falls back to the plain /start
+	b.fake.SendMessage(testChatID, testUserID, "/start unsub_101x")
+
+	if text := b.waitFor("sendMessage", 1).Text(); text != "Started!" {
+		t.Errorf("bad payload sent %q, want Started!", text)
+	}
+
+	b.fake.SendMessage(testChatID, testUserID, "/start unsub_102")
+
+	if text := b.waitFor("sendMessage", 3).Text(); text !=
+		"You are not subscribed to Frieren Beta" {
+		t.Errorf("unsubscribed payload sent %q", text)
+	}
+
+	// Following the link only asks
+	b.fake.SendMessage(testChatID, testUserID, "/start unsub_z101")
+
+	question := b.waitFor("sendMessage", 5)
+
+	if !strings.Contains(question.Text(), "Unsubscribe from this anime?") ||
+		!strings.Contains(question.Text(), "Frieren Alpha") {
+		t.Fatalf("link sent %q, want the question with the card", question.Text())
+	}
+
+	if b.subscriptions.Find(ctx, testUserID, "101") == nil {
+		t.Fatal("following the link unsubscribed without asking")
+	}
+
+	// A button made up without the session's nonce is stale
+	forged := callbackData{action: actionConfirm, id: "1", nonce: "x"}
+
+	b.fake.PressButton(testChatID, testUserID, question.SentMessageID,
+		forged.encode())
+	b.waitFor("answerCallbackQuery", 1)
+
+	if b.subscriptions.Find(ctx, testUserID, "101") == nil {
+		t.Fatal("a forged button unsubscribed")
+	}
+
+	// Confirming on a fresh question does
+	b.fake.SendMessage(testChatID, testUserID, "/start unsub_101")
+	question = b.waitFor("sendMessage", 6)
+
+	b.fake.PressButton(testChatID, testUserID, question.SentMessageID,
+		b.button(question.Keyboard(), actionConfirm, "1"))
+
+	// The card has no poster, so it is text and edited into the outcome
+	if text := b.waitFor("editMessageText", 1).Text(); text !=
+		"You are unsubscribed from Frieren Alpha" {
+		t.Errorf("confirm sent %q", text)
+	}
+
+	if s := b.subscriptions.FindAll(ctx, testUserID); len(s) != 0 {
+		t.Errorf("subscriptions left: %v", s)
+	}
+}
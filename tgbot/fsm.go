@@ -0,0 +1,163 @@
+package tgbot
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"smOwd/animes"
+	"smOwd/logs"
+	"smOwd/subscriptions"
+	"smOwd/users"
+
+	"github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+// expiredText is sent when a user comes back to a screen after its state
+// timed out.
+const expiredText = "That menu has expired, let's start over"
+
+// conversation is what state functions work with while handling one update.
+type conversation struct {
+	ctx     context.Context
+	logger  *logs.Logger
+	bot     Messenger
+	catalog animes.AnimeSource
+	update  tgbotapi.Update
+	user    *users.User
+	chatID  int
+	session *sessionData
+
+	userStore         users.UserStore
+	subscriptionStore subscriptions.SubscriptionStore
+
+	// text is the message text or the pressed button's callback data
+	text string
+
+	// callback is the pressed button, read by readCallback
+	callback callbackData
+
+	// callbackText is shown to the user as a toast when a button was pressed
+	callbackText string
+}
+
+func (c *conversation) isCallback() bool {
+	return c.update.CallbackQuery != nil
+}
+
+func (c *conversation) send(text string) {
+	c.bot.Send(tgbotapi.NewMessage(int64(c.chatID), text))
+}
+
+// sendMenu shows the main menu as the chat's screen, see reply.
+func (c *conversation) sendMenu() {
+	keyboard := menuKeyboard(c.session, c.user.Enabled)
+
+	c.reply(menuText, &keyboard)
+}
+
+// state is one step of a conversation. handle processes an update and
+// returns the state to continue in; enter and exit, when set, run as the
+// conversation moves into and out of the state. A state whose timeout has
+// passed since the user's last update is left for Basic instead.
+type state struct {
+	mode        handleUpdateMode
+	name        string
+	timeout     time.Duration
+	transitions []handleUpdateMode
+
+	enter  func(c *conversation)
+	handle func(c *conversation) handleUpdateMode
+	exit   func(c *conversation)
+}
+
+// states holds every registered state. Each flow registers its states from
+// its own file with registerState.
+var states = make(map[handleUpdateMode]*state)
+
+func registerState(s *state) {
+	if _, ok := states[s.mode]; ok {
+		panic(fmt.Sprintf("tgbot: state %s registered twice", s.name))
+	}
+	states[s.mode] = s
+}
+
+// run hands the update to the session's current state and performs the
+// transition it asks for.
+func (c *conversation) run() {
+	current, ok := states[c.session.handleUpdateModeField]
+
+	if !ok {
+		c.logger.Warn("Unknown session state, resetting",
+			"state", c.session.handleUpdateModeField)
+
+		c.enter(handleUpdateModeBasic)
+		return
+	}
+
+	if current.timeout > 0 && !c.session.updatedAt.IsZero() &&
+		time.Since(c.session.updatedAt) > current.timeout {
+		c.logger.Info("Session state timed out",
+			"state", current.name,
+			"tgname", c.user.UserName)
+
+		if c.isCallback() {
+			c.callbackText = expiredText
+		} else {
+			c.send(expiredText)
+		}
+
+		c.transition(current, handleUpdateModeBasic)
+		return
+	}
+
+	c.handleIn(current)
+}
+
+// handleIn lets s handle the update and moves on to the state it returns.
+func (c *conversation) handleIn(s *state) {
+	c.logger.Info("Update handle mode "+s.name, "tgname", c.user.UserName)
+
+	if next := s.handle(c); next != s.mode {
+		c.transition(s, next)
+	}
+}
+
+// interrupt abandons whatever flow the conversation is in and puts it back
+// in Basic without showing the menu, for commands that work from any state.
+func (c *conversation) interrupt() {
+	if current, ok := states[c.session.handleUpdateModeField]; ok &&
+		current.exit != nil {
+		current.exit(c)
+	}
+
+	c.session.clear()
+	c.session.renewNonce()
+	c.session.handleUpdateModeField = handleUpdateModeBasic
+}
+
+func (c *conversation) transition(from *state, to handleUpdateMode) {
+	if !slices.Contains(from.transitions, to) {
+		c.logger.Error("Transition not allowed, resetting",
+			"from", from.mode,
+			"to", to)
+
+		to = handleUpdateModeBasic
+	}
+
+	if from.exit != nil {
+		from.exit(c)
+	}
+
+	c.enter(to)
+}
+
+func (c *conversation) enter(mode handleUpdateMode) {
+	c.session.handleUpdateModeField = mode
+	c.session.renewNonce()
+
+	if next, ok := states[mode]; ok && next.enter != nil {
+		next.enter(c)
+	}
+}
@@ -0,0 +1,125 @@
+package tgbot
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"smOwd/animes"
+	"smOwd/cards"
+	"smOwd/logs"
+
+	"github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+const (
+	// inlinePageSize is the number of results per inline answer; Telegram
+	// asks for the next page with the offset we return.
+	inlinePageSize = 20
+
+	// inlineCacheTime is how long Telegram may reuse an answer, in seconds.
+	inlineCacheTime = 300
+
+	// inlineTimeout bounds the search behind an answer. Telegram drops
+	// queries not answered within about 10 seconds, and a query is typed
+	// again on every keystroke, so a slow answer is worth nothing.
+	inlineTimeout = 5 * time.Second
+)
+
+// handleInlineQuery answers "@bot <title>" typed in any chat with matching
+// animes. Sharing one posts its card with a Subscribe button that opens the
+// bot through a deep link, so anyone in the chat can follow the show.
+func handleInlineQuery(ctx context.Context, bot Messenger,
+	query *tgbotapi.InlineQuery, catalog animes.AnimeSource,
+	botUserName string) {
+	logger := logs.DefaultFromCtx(ctx)
+
+	title := strings.TrimSpace(query.Query)
+
+	answer := tgbotapi.InlineConfig{
+		InlineQueryID: query.ID,
+		Results:       []interface{}{},
+		CacheTime:     inlineCacheTime,
+	}
+
+	if title == "" {
+		bot.AnswerInlineQuery(answer)
+		return
+	}
+
+	page, err := strconv.Atoi(query.Offset)
+	if err != nil || page < 1 {
+		page = 1
+	}
+
+	searchCtx, cancel := context.WithTimeout(ctx, inlineTimeout)
+	defer cancel()
+
+	sliceAnime, err := catalog.SearchAnimeByName(searchCtx, title,
+		animes.SearchOptions{Page: page, Limit: inlinePageSize})
+
+	if err != nil {
+		logger.Error("Error searching for inline query",
+			"Anime name", title,
+			"error", err)
+
+		// Don't let Telegram cache the failure
+		answer.CacheTime = 0
+		bot.AnswerInlineQuery(answer)
+		return
+	}
+
+	for _, a := range sliceAnime {
+		answer.Results = append(answer.Results, inlineArticle(a, botUserName))
+	}
+
+	if len(sliceAnime) == inlinePageSize {
+		answer.NextOffset = strconv.Itoa(page + 1)
+	}
+
+	logger.Info("Answering inline query",
+		"Anime name", title,
+		"Page", page,
+		"results", len(answer.Results))
+
+	if err := bot.AnswerInlineQuery(answer); err != nil {
+		logger.Error("Error answering inline query", "error", err)
+	}
+}
+
+func inlineArticle(a animes.Anime, botUserName string) tgbotapi.InlineQueryResultArticle {
+	title := a.English
+	if title == "" {
+		title = a.Name
+	}
+
+	article := tgbotapi.NewInlineQueryResultArticleHTML(a.ShikiID, title,
+		cards.Text(a))
+
+	article.URL = a.URL
+	article.Description = inlineDescription(a)
+
+	if a.Poster != nil {
+		article.ThumbURL = a.Poster.MainURL
+	}
+
+	if a.Status != "released" {
+		keyboard := tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonURL("Subscribe",
+				cards.SubscribeLink(botUserName, a.ShikiID))))
+		article.ReplyMarkup = &keyboard
+	}
+
+	return article
+}
+
+// inlineDescription is the line under the title, e.g. "ongoing, 3/10 episodes".
+func inlineDescription(a animes.Anime) string {
+	if a.Episodes > 0 {
+		return fmt.Sprintf("%s, %d/%d episodes", a.Status, a.EpisodesAired,
+			a.Episodes)
+	}
+	return fmt.Sprintf("%s, %d episodes", a.Status, a.EpisodesAired)
+}
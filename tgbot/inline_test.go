@@ -0,0 +1,107 @@
+package tgbot
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+	"testing"
+	"time"
+
+	"smOwd/animes"
+	"smOwd/tgbot/tgfake"
+
+	"github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+func TestInlineQuery(t *testing.T) {
+	b := startTestBot(t, testAnimes)
+
+	b.fake.SendInlineQuery(testUserID, "frieren", "")
+
+	answer := b.waitFor("answerInlineQuery", 1)
+
+	var results []struct {
+		ID          string `json:"id"`
+		ReplyMarkup struct {
+			InlineKeyboard [][]struct {
+				URL string `json:"url"`
+			} `json:"inline_keyboard"`
+		} `json:"reply_markup"`
+	}
+
+	if err := json.Unmarshal([]byte(answer.Params.Get("results")), &results); err != nil {
+		t.Fatal(err)
+	}
+
+	var ids []string
+
+	for _, r := range results {
+		ids = append(ids, r.ID)
+	}
+
+	if !slices.Equal(ids, []string{"101", "102", "103"}) {
+		t.Fatalf("results %v, want 101 102 103", ids)
+	}
+
+	if keyboard := results[0].ReplyMarkup.InlineKeyboard; len(keyboard) != 1 ||
+		keyboard[0][0].URL != "https://t.me/fake_bot?start=sub_101" {
+		t.Errorf("first result buttons %v, want a Subscribe deep link", keyboard)
+	}
+
+	// An empty query is answered right away, without asking the catalog
+	requests := len(b.shiki.Requests())
+
+	b.fake.SendInlineQuery(testUserID, " ", "")
+
+	answer = b.waitFor("answerInlineQuery", 2)
+
+	if answer.Params.Get("results") != "[]" {
+		t.Errorf("empty query results %s, want none", answer.Params.Get("results"))
+	}
+
+	if len(b.shiki.Requests()) != requests {
+		t.Errorf("empty query searched the catalog")
+	}
+}
+
+// deadlineSource fails every search, remembering the deadline it was given.
+type deadlineSource struct {
+	animes.AnimeSource
+	deadline time.Time
+	ok       bool
+}
+
+func (s *deadlineSource) SearchAnimeByName(ctx context.Context, name string,
+	opts animes.SearchOptions) ([]animes.Anime, error) {
+	s.deadline, s.ok = ctx.Deadline()
+	return nil, &animes.NetworkError{Err: animes.ErrRateLimited}
+}
+
+func TestInlineQueryTimeout(t *testing.T) {
+	fake := tgfake.New()
+	ts := fake.Start()
+	defer ts.Close()
+
+	api, err := tgfake.NewBotAPI(ts, "token")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	source := &deadlineSource{}
+
+	handleInlineQuery(ctx, NewMessenger(api),
+		&tgbotapi.InlineQuery{ID: "1", Query: "frieren"}, source, "fake_bot")
+
+	if !source.ok || source.deadline.After(time.Now().Add(inlineTimeout)) {
+		t.Errorf("search deadline %v, %v, want within %v", source.deadline,
+			source.ok, inlineTimeout)
+	}
+
+	calls := fake.CallsTo("answerInlineQuery")
+
+	if len(calls) != 1 || calls[0].Params.Get("cache_time") != "0" ||
+		calls[0].Params.Get("results") != "[]" {
+		t.Errorf("answers %v, want one uncached empty answer", calls)
+	}
+}
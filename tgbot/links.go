@@ -0,0 +1,121 @@
+package tgbot
+
+import (
+	"context"
+	"errors"
+	"regexp"
+
+	"smOwd/animes"
+
+	"github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+var (
+	// shikimoriLinkRe matches shikimori.one/animes/52991-sousou-no-frieren;
+	// ids of some animes carry a letter prefix, like /animes/z52991.
+	shikimoriLinkRe = regexp.MustCompile(
+		`(?i)shikimori\.(?:one|me|org)/animes/[a-z]?(\d+)`)
+
+	// malLinkRe matches myanimelist.net/anime/52991/Sousou_no_Frieren.
+	malLinkRe = regexp.MustCompile(`(?i)myanimelist\.net/anime/(\d+)`)
+)
+
+// animeLink is an anime page link found in a message. Exactly one of the
+// ids is set.
+type animeLink struct {
+	shikiID string
+	malID   string
+}
+
+// findAnimeLink looks for a Shikimori or MyAnimeList anime link in the text
+// of msg and in the links hidden behind its formatted text.
+func findAnimeLink(msg *tgbotapi.Message) (animeLink, bool) {
+	texts := []string{msg.Text, msg.Caption}
+
+	if msg.Entities != nil {
+		for _, e := range *msg.Entities {
+			if e.Type == "text_link" {
+				texts = append(texts, e.URL)
+			}
+		}
+	}
+
+	for _, text := range texts {
+		if m := shikimoriLinkRe.FindStringSubmatch(text); m != nil {
+			return animeLink{shikiID: m[1]}, true
+		}
+		if m := malLinkRe.FindStringSubmatch(text); m != nil {
+			return animeLink{malID: m[1]}, true
+		}
+	}
+
+	return animeLink{}, false
+}
+
+// resolveAnimeLink looks the linked anime up in catalog. Shikimori mirrors
+// MyAnimeList ids, so MAL links are looked up by the same id and only
+// accepted if the result's malId matches.
+func resolveAnimeLink(ctx context.Context, catalog animes.AnimeSource,
+	link animeLink) (*animes.Anime, error) {
+	if link.shikiID != "" {
+		return catalog.GetAnimeDetails(ctx, link.shikiID)
+	}
+
+	sliceAnime, err := catalog.SearchAnimeByShikiIDs(ctx, []string{link.malID})
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, a := range sliceAnime {
+		if a.MalID == link.malID {
+			return &a, nil
+		}
+	}
+
+	return nil, animes.ErrAnimeNotFound
+}
+
+// runAnimeLink offers to subscribe to the anime linked in the update's
+// message, if any, and reports whether it did.
+func (c *conversation) runAnimeLink() bool {
+	msg := c.update.Message
+
+	if msg == nil {
+		return false
+	}
+
+	link, ok := findAnimeLink(msg)
+
+	if !ok {
+		return false
+	}
+
+	c.logger.Info("Anime link",
+		"Shiki ID", link.shikiID,
+		"MAL ID", link.malID,
+		"tgname", c.user.UserName)
+
+	c.interrupt()
+
+	anime, err := resolveAnimeLink(c.ctx, c.catalog, link)
+
+	if errors.Is(err, animes.ErrAnimeNotFound) {
+		c.send("Couldn't find that anime")
+		c.sendMenu()
+		return true
+	} else if err != nil {
+		c.logger.Error("Error resolving anime link",
+			"Shiki ID", link.shikiID,
+			"MAL ID", link.malID,
+			"error", err)
+
+		c.send(catalogErrorText(err))
+		c.sendMenu()
+		return true
+	}
+
+	c.offer(*anime)
+
+	return true
+}
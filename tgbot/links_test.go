@@ -0,0 +1,126 @@
+package tgbot
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"smOwd/animes"
+	"smOwd/animes/shikifake"
+
+	"github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+func TestFindAnimeLink(t *testing.T) {
+	tests := []struct {
+		name     string
+		msg      tgbotapi.Message
+		want     animeLink
+		wantFind bool
+	}{
+		{"shikimori.one",
+			tgbotapi.Message{Text: "https://shikimori.one/animes/52991-sousou-no-frieren"},
+			animeLink{shikiID: "52991"}, true},
+		{"shikimori.me",
+			tgbotapi.Message{Text: "look shikimori.me/animes/52991"},
+			animeLink{shikiID: "52991"}, true},
+		{"shikimori.org",
+			tgbotapi.Message{Text: "http://shikimori.org/animes/52991-sousou-no-frieren"},
+			animeLink{shikiID: "52991"}, true},
+		{"letter prefix",
+			tgbotapi.Message{Text: "https://shikimori.one/animes/z52991-sousou-no-frieren"},
+			animeLink{shikiID: "52991"}, true},
+		{"letter prefix on .me",
+			tgbotapi.Message{Text: "https://shikimori.me/animes/y52991"},
+			animeLink{shikiID: "52991"}, true},
+		{"caption",
+			tgbotapi.Message{Caption: "https://shikimori.one/animes/52991"},
+			animeLink{shikiID: "52991"}, true},
+		{"text_link",
+			tgbotapi.Message{
+				Text: "watch this",
+				Entities: &[]tgbotapi.MessageEntity{
+					{Type: "bold", Offset: 0, Length: 5},
+					{Type: "text_link", Offset: 6, Length: 4,
+						URL: "https://shikimori.one/animes/z52991-sousou-no-frieren"},
+				},
+			},
+			animeLink{shikiID: "52991"}, true},
+		{"mal",
+			tgbotapi.Message{Text: "https://myanimelist.net/anime/52991/Sousou_no_Frieren"},
+			animeLink{malID: "52991"}, true},
+		{"mal text_link",
+			tgbotapi.Message{
+				Text: "watch this",
+				Entities: &[]tgbotapi.MessageEntity{
+					{Type: "text_link", Offset: 6, Length: 4,
+						URL: "https://myanimelist.net/anime/52991"},
+				},
+			},
+			animeLink{malID: "52991"}, true},
+		{"other site",
+			tgbotapi.Message{Text: "https://example.com/animes/52991"},
+			animeLink{}, false},
+		{"manga",
+			tgbotapi.Message{Text: "https://shikimori.one/mangas/52991"},
+			animeLink{}, false},
+		{"no link",
+			tgbotapi.Message{Text: "frieren"},
+			animeLink{}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := findAnimeLink(&tt.msg)
+
+			if got != tt.want || ok != tt.wantFind {
+				t.Errorf("findAnimeLink = %+v, %v, want %+v, %v", got, ok,
+					tt.want, tt.wantFind)
+			}
+		})
+	}
+}
+
+func TestResolveAnimeLink(t *testing.T) {
+	shiki := shikifake.New([]animes.Anime{
+		{ShikiID: "52991", MalID: "52991", English: "Frieren"},
+		// Shikimori's own entry, its id isn't a MAL one
+		{ShikiID: "60000", MalID: "1", English: "Not On MAL"},
+	}).Start()
+	defer shiki.Close()
+
+	catalog := animes.NewShikimori(shiki.URL)
+
+	tests := []struct {
+		name    string
+		link    animeLink
+		want    string
+		wantErr error
+	}{
+		{"shikimori", animeLink{shikiID: "52991"}, "52991", nil},
+		{"shikimori unknown", animeLink{shikiID: "404"}, "",
+			animes.ErrAnimeNotFound},
+		{"mal", animeLink{malID: "52991"}, "52991", nil},
+		{"mal id of another anime", animeLink{malID: "60000"}, "",
+			animes.ErrAnimeNotFound},
+		{"mal unknown", animeLink{malID: "404"}, "", animes.ErrAnimeNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			anime, err := resolveAnimeLink(context.Background(), catalog, tt.link)
+
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("resolveAnimeLink = %v, %v, want %v", anime, err,
+						tt.wantErr)
+				}
+				return
+			}
+
+			if err != nil || anime.ShikiID != tt.want {
+				t.Errorf("resolveAnimeLink = %v, %v, want %s", anime, err, tt.want)
+			}
+		})
+	}
+}
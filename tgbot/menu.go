@@ -0,0 +1,125 @@
+package tgbot
+
+import (
+	"fmt"
+	"strconv"
+)
+
+func init() {
+	registerState(&state{
+		mode: handleUpdateModeBasic,
+		name: "Basic",
+		transitions: []handleUpdateMode{
+			handleUpdateModeSearch,
+			handleUpdateModeRemove,
+			handleUpdateModeOffer,
+			handleUpdateModeUnsubscribe,
+		},
+		enter:  (*conversation).sendMenu,
+		handle: handleBasic,
+	})
+}
+
+// handleBasic runs the main menu buttons.
+func handleBasic(c *conversation) handleUpdateMode {
+	c.session.clear()
+
+	switch c.callback.action {
+	case actionEnable:
+		setNotifications(c, true)
+	case actionDisable:
+		setNotifications(c, false)
+	case actionSearch:
+		return handleUpdateModeSearch
+	case actionSubscriptions:
+		showSubscriptions(c)
+		c.sendMenu()
+	case actionRemove:
+		return startRemove(c)
+	}
+
+	return handleUpdateModeBasic
+}
+
+func setNotifications(c *conversation, enabled bool) {
+	var err error
+
+	if enabled {
+		err = c.userStore.Enable(c.ctx, c.user.ID)
+	} else {
+		err = c.userStore.Disable(c.ctx, c.user.ID)
+	}
+
+	if err != nil {
+		c.logger.Error("Failed to change notifications",
+			"Telegram username", c.user.UserName,
+			"enabled", enabled,
+			"error", err)
+
+		c.sendMenu()
+		return
+	}
+
+	c.user.Enabled = enabled
+
+	if enabled {
+		c.logger.Info("Enabled notifications",
+			"Telegram username", c.user.UserName)
+
+		c.notify("Enabled notifications")
+	} else {
+		c.logger.Info("Disabled notifications",
+			"Telegram username", c.user.UserName)
+
+		c.notify("Disabled notifications")
+	}
+
+	c.sendMenu()
+}
+
+func showSubscriptions(c *conversation) {
+	sliceSubscriptions := c.subscriptionStore.FindAll(c.ctx, c.user.TelegramID)
+
+	if len(sliceSubscriptions) == 0 {
+		c.reply("You have no subscriptions", nil)
+		return
+	}
+
+	outputMsgText := "You are subscribed to these animes:\n\n"
+
+	var shikiIDs []string
+
+	for _, s := range sliceSubscriptions {
+		shikiIDs = append(shikiIDs, s.ShikiID)
+	}
+
+	sliceAnime, err := c.catalog.SearchAnimeByShikiIDs(c.ctx, shikiIDs)
+
+	if err != nil {
+		c.logger.Error("Error searching animes by ids",
+			"IDs", shikiIDs,
+			"error", err)
+
+		c.reply(catalogErrorText(err), nil)
+		return
+	}
+
+	for i, a := range sliceAnime {
+		line := strconv.Itoa(i+1) + ". " + a.English + " / " + a.URL + "\n"
+		outputMsgText += line
+		outputMsgText += fmt.Sprintf("Last episode aired: %d\n", a.EpisodesAired)
+
+		var lastNotification int
+
+		for _, s := range sliceSubscriptions {
+			if c.user.TelegramID == s.TelegramID && s.ShikiID == a.ShikiID {
+				lastNotification = s.LastEpisodeNotified
+				break
+			}
+		}
+
+		outputMsgText += fmt.Sprintf("Last episode notified of: %d\n\n", lastNotification)
+	}
+
+	c.reply(outputMsgText, nil)
+}
@@ -0,0 +1,59 @@
+package tgbot
+
+import (
+	"github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+// Messenger is everything the chat handlers need from Telegram. The bot
+// uses BotAPI through NewMessenger; a fake Bot API server (see tgfake) can
+// stand behind the same BotAPI in tests.
+type Messenger interface {
+	// Send sends a new message, photo or other Chattable.
+	Send(c tgbotapi.Chattable) (tgbotapi.Message, error)
+
+	// Edit changes a message already sent, e.g. with
+	// tgbotapi.NewEditMessageText or tgbotapi.NewEditMessageReplyMarkup.
+	Edit(c tgbotapi.Chattable) error
+
+	// AnswerCallback acknowledges a button press, showing text as a toast
+	// unless it is empty.
+	AnswerCallback(callbackID string, text string) error
+
+	// Delete removes a message from the chat.
+	Delete(chatID int64, messageID int) error
+
+	// AnswerInlineQuery sends the results for an inline query.
+	AnswerInlineQuery(config tgbotapi.InlineConfig) error
+}
+
+type botMessenger struct {
+	bot *tgbotapi.BotAPI
+}
+
+func NewMessenger(bot *tgbotapi.BotAPI) Messenger {
+	return &botMessenger{bot: bot}
+}
+
+func (m *botMessenger) Send(c tgbotapi.Chattable) (tgbotapi.Message, error) {
+	return m.bot.Send(c)
+}
+
+func (m *botMessenger) Edit(c tgbotapi.Chattable) error {
+	_, err := m.bot.Send(c)
+	return err
+}
+
+func (m *botMessenger) AnswerCallback(callbackID string, text string) error {
+	_, err := m.bot.AnswerCallbackQuery(tgbotapi.NewCallback(callbackID, text))
+	return err
+}
+
+func (m *botMessenger) Delete(chatID int64, messageID int) error {
+	_, err := m.bot.DeleteMessage(tgbotapi.NewDeleteMessage(chatID, messageID))
+	return err
+}
+
+func (m *botMessenger) AnswerInlineQuery(config tgbotapi.InlineConfig) error {
+	_, err := m.bot.AnswerInlineQuery(config)
+	return err
+}
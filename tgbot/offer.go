@@ -0,0 +1,83 @@
+package tgbot
+
+import (
+	"time"
+
+	"smOwd/animes"
+
+	"github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+const offerTimeout = time.Hour
+
+func init() {
+	registerState(&state{
+		mode:        handleUpdateModeOffer,
+		name:        "Offer",
+		timeout:     offerTimeout,
+		transitions: []handleUpdateMode{handleUpdateModeBasic},
+		enter:       (*conversation).showOffer,
+		handle:      handleOffer,
+	})
+}
+
+// offer shows the card of anime with a one-tap Subscribe button, e.g. for
+// a pasted link. The conversation must be in Basic.
+func (c *conversation) offer(anime animes.Anime) {
+	c.session.sliceAnime = []animes.Anime{anime}
+
+	c.transition(states[handleUpdateModeBasic], handleUpdateModeOffer)
+}
+
+// handleOffer handles the buttons under an offered anime.
+func handleOffer(c *conversation) handleUpdateMode {
+	session := c.session
+
+	if !c.isCallback() {
+		c.logger.Warn("No button pressed")
+
+		c.send("Don't text, press a button")
+
+		c.showOffer()
+
+		return handleUpdateModeOffer
+	} else if c.callback.action == actionCancel {
+		return handleUpdateModeBasic
+	} else if c.callback.action != actionSubscribe ||
+		len(session.sliceAnime) != 1 ||
+		session.sliceAnime[0].ShikiID != c.callback.id {
+		c.logger.Warn("Stale or unknown button", "data", c.text)
+
+		c.callbackText = staleButtonText
+
+		return handleUpdateModeBasic
+	}
+
+	c.reply(subscribe(c, session.sliceAnime[0]), nil)
+
+	return handleUpdateModeBasic
+}
+
+// showOffer shows the offered anime as the chat's screen.
+func (c *conversation) showOffer() {
+	if len(c.session.sliceAnime) == 0 {
+		return
+	}
+
+	anime := c.session.sliceAnime[0]
+
+	var buttons []tgbotapi.InlineKeyboardButton
+
+	if anime.Status != "released" {
+		buttons = append(buttons,
+			tgbotapi.NewInlineKeyboardButtonData("Subscribe",
+				c.session.callback(actionSubscribe, anime.ShikiID)))
+	}
+
+	buttons = append(buttons, tgbotapi.NewInlineKeyboardButtonData("Cancel",
+		c.session.callback(actionCancel, "")))
+
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(buttons)
+
+	c.replyCard(anime, "", &keyboard)
+}
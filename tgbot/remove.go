@@ -0,0 +1,240 @@
+package tgbot
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"smOwd/misc"
+	"smOwd/subscriptions"
+
+	"github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+const removeTimeout = time.Hour
+
+func init() {
+	registerState(&state{
+		mode:        handleUpdateModeRemove,
+		name:        "Remove",
+		timeout:     removeTimeout,
+		transitions: []handleUpdateMode{handleUpdateModeBasic},
+		enter:       (*conversation).showRemoveList,
+		handle:      handleRemove,
+	})
+}
+
+// startRemove loads the user's subscriptions for the Remove screen.
+func startRemove(c *conversation) handleUpdateMode {
+	var shikiIDs []string
+
+	sliceSubscriptions := c.subscriptionStore.FindAll(c.ctx, c.user.TelegramID)
+
+	if sliceSubscriptions == nil {
+		c.logger.Error("Error getting subscriptions from DB",
+			"Telegram ID", c.user.TelegramID)
+
+		c.sendMenu()
+		return handleUpdateModeBasic
+	} else if len(sliceSubscriptions) == 0 {
+		c.reply("You have no subscriptions", nil)
+		c.sendMenu()
+		return handleUpdateModeBasic
+	}
+
+	for _, s := range sliceSubscriptions {
+		shikiIDs = append(shikiIDs, s.ShikiID)
+	}
+
+	sliceAnime, err := c.catalog.SearchAnimeByShikiIDs(c.ctx, shikiIDs)
+
+	if err != nil {
+		c.logger.Error("Error searching animes by ids",
+			"IDs", shikiIDs,
+			"error", err)
+
+		c.reply(catalogErrorText(err), nil)
+		c.sendMenu()
+		return handleUpdateModeBasic
+	}
+
+	attachAnimes(c.ctx, c.session, sliceSubscriptions, sliceAnime)
+
+	return handleUpdateModeRemove
+}
+
+// handleRemove handles the buttons under the subscription list. Number
+// buttons tick subscriptions and Confirm removes the ticked ones; typing
+// numbers like "1-4, 7" removes those right away.
+func handleRemove(c *conversation) handleUpdateMode {
+	session := c.session
+
+	if !c.isCallback() {
+		return removeTyped(c)
+	}
+
+	switch c.callback.action {
+	case actionCancel:
+		return handleUpdateModeBasic
+	case actionConfirm:
+		return removeSelected(c)
+	}
+
+	id, err := c.callback.intID()
+
+	i := slices.IndexFunc(session.sliceSubscriptions,
+		func(s subscriptions.Subscription) bool { return s.ID == id })
+
+	if c.callback.action != actionToggle || err != nil || i < 0 {
+		c.logger.Warn("Stale or unknown button", "data", c.text)
+
+		c.callbackText = staleButtonText
+
+		return handleUpdateModeBasic
+	}
+
+	s := session.sliceSubscriptions[i]
+
+	if session.toggle(s.ShikiID) {
+		c.callbackText = "Selected " + s.Anime.English
+	} else {
+		c.callbackText = "Unselected " + s.Anime.English
+	}
+
+	c.showRemoveList()
+
+	return handleUpdateModeRemove
+}
+
+// removeTyped removes the subscriptions numbered in the message.
+func removeTyped(c *conversation) handleUpdateMode {
+	session := c.session
+
+	ok, numbers := misc.ParseSelection(c.text)
+
+	var sliceSubscriptions []subscriptions.Subscription
+
+	for _, n := range numbers {
+		if n >= 1 && n <= len(session.sliceSubscriptions) {
+			sliceSubscriptions = append(sliceSubscriptions,
+				session.sliceSubscriptions[n-1])
+		} else {
+			ok = false
+		}
+	}
+
+	if !ok {
+		c.logger.Warn("No button pressed")
+
+		c.send("Press a button or type the numbers of the animes, " +
+			"e.g. 1-4, 7")
+
+		c.showRemoveList()
+
+		return handleUpdateModeRemove
+	}
+
+	removeAll(c, sliceSubscriptions)
+
+	return handleUpdateModeBasic
+}
+
+func removeSelected(c *conversation) handleUpdateMode {
+	var sliceSubscriptions []subscriptions.Subscription
+
+	for _, s := range c.session.sliceSubscriptions {
+		if c.session.selected[s.ShikiID] {
+			sliceSubscriptions = append(sliceSubscriptions, s)
+		}
+	}
+
+	if len(sliceSubscriptions) == 0 {
+		c.callbackText = "Nothing selected"
+		return handleUpdateModeRemove
+	}
+
+	removeAll(c, sliceSubscriptions)
+
+	return handleUpdateModeBasic
+}
+
+func removeAll(c *conversation, sliceSubscriptions []subscriptions.Subscription) {
+	var lines []string
+
+	for _, s := range sliceSubscriptions {
+		err := c.subscriptionStore.Remove(c.ctx, s.ID)
+
+		if err != nil {
+			c.logger.Error("Error removing subscription",
+				"Telegram ID", s.TelegramID,
+				"Shiki ID", s.ShikiID,
+				"error", err)
+
+			lines = append(lines,
+				fmt.Sprintf("Failed to unsubscribe from %s", s.Anime.English))
+			continue
+		}
+
+		c.logger.Info("Removed subscription",
+			"Telegram ID", s.TelegramID,
+			"Shiki ID", s.ShikiID)
+
+		lines = append(lines,
+			fmt.Sprintf("You are unsubscribed from %s", s.Anime.English))
+	}
+
+	c.reply(strings.Join(lines, "\n"), nil)
+}
+
+// removeListMessage renders the session's subscriptions with a checkbox
+// button each, Confirm once something is ticked, and Cancel.
+func removeListMessage(session *sessionData) (string,
+	tgbotapi.InlineKeyboardMarkup) {
+	outputMsgText := "Choose animes to unscubscribe from:\n\n"
+
+	var buttons []tgbotapi.InlineKeyboardButton
+	var keyboard [][]tgbotapi.InlineKeyboardButton
+
+	for i, s := range session.sliceSubscriptions {
+		a := s.Anime
+
+		line := strconv.Itoa(i+1) + ". " + a.English + " / " + a.URL + "\n"
+		outputMsgText += line
+
+		buttons = append(buttons, checkboxButton(strconv.Itoa(i+1),
+			session.callback(actionToggle, strconv.Itoa(s.ID)),
+			session.selected[a.ShikiID]))
+
+		if len(buttons) > 4 {
+			keyboard = append(keyboard, buttons)
+			buttons = []tgbotapi.InlineKeyboardButton{}
+		}
+	}
+	if len(buttons) > 0 {
+		keyboard = append(keyboard, buttons)
+	}
+
+	outputMsgText += "\n" + selectionHint
+
+	if len(session.selected) > 0 {
+		keyboard = append(keyboard, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(
+				fmt.Sprintf("Unsubscribe from %d selected", len(session.selected)),
+				session.callback(actionConfirm, ""))))
+	}
+
+	keyboard = append(keyboard, tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("Cancel",
+			session.callback(actionCancel, ""))))
+
+	return outputMsgText, tgbotapi.NewInlineKeyboardMarkup(keyboard...)
+}
+
+// showRemoveList shows the subscription list as the chat's screen.
+func (c *conversation) showRemoveList() {
+	msgText, keyboard := removeListMessage(c.session)
+
+	c.reply(msgText, &keyboard)
+}
@@ -0,0 +1,143 @@
+package tgbot
+
+import (
+	"strings"
+
+	"smOwd/animes"
+	"smOwd/cards"
+
+	"github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+// A screen is the one message per chat whose buttons are live: the menu, a
+// list, an offer. session.lastTgMsgID points at it, 0 when there is none.
+// Buttons on any other message are stale.
+
+// reply shows a screen. A button press on the current screen edits it in
+// place; anything else sends a new message and takes the buttons off the
+// old screen. A nil keyboard shows text with no buttons, e.g. the outcome of
+// a flow, and leaves the chat without a screen.
+func (c *conversation) reply(text string, keyboard *tgbotapi.InlineKeyboardMarkup) {
+	session := c.session
+
+	if c.fromScreen() && !c.fromCard() {
+		edit := tgbotapi.NewEditMessageText(int64(c.chatID), session.lastTgMsgID, text)
+		edit.ReplyMarkup = keyboard
+		edit.DisableWebPagePreview = true
+
+		err := c.bot.Edit(edit)
+
+		if err == nil || isNotModified(err) {
+			if keyboard == nil {
+				session.lastTgMsgID = 0
+			}
+			return
+		}
+
+		c.logger.Warn("Failed to edit screen, sending a new one", "error", err)
+	} else {
+		c.retireScreen()
+	}
+
+	msg := tgbotapi.NewMessage(int64(c.chatID), text)
+	msg.DisableWebPagePreview = true
+
+	if keyboard != nil {
+		msg.ReplyMarkup = *keyboard
+	}
+
+	session.lastTgMsgID = 0
+
+	sent, err := c.bot.Send(msg)
+
+	if err == nil && keyboard != nil {
+		session.lastTgMsgID = sent.MessageID
+	}
+}
+
+// replyCard shows a's card under header as the chat's screen, see
+// cards.Send. A card is always sent as a new message, a text screen can't be
+// edited into a photo.
+func (c *conversation) replyCard(a animes.Anime, header string,
+	keyboard *tgbotapi.InlineKeyboardMarkup) {
+	c.retireScreen()
+
+	sent, err := cards.Send(c.bot, int64(c.chatID), a, header, keyboard)
+
+	if err == nil && keyboard != nil {
+		c.session.lastTgMsgID = sent.MessageID
+	}
+}
+
+// fromCard reports whether the pressed button is under a photo, which only
+// cards are. Its caption is left as it is, replies go out as new messages.
+func (c *conversation) fromCard() bool {
+	query := c.update.CallbackQuery
+
+	return query != nil && query.Message != nil && query.Message.Photo != nil
+}
+
+// fromScreen reports whether the update is a button press on the screen.
+func (c *conversation) fromScreen() bool {
+	query := c.update.CallbackQuery
+
+	return query != nil && query.Message != nil &&
+		c.session.lastTgMsgID != 0 &&
+		query.Message.MessageID == c.session.lastTgMsgID
+}
+
+// retireScreen takes the buttons off the current screen.
+func (c *conversation) retireScreen() {
+	if c.session.lastTgMsgID == 0 {
+		return
+	}
+
+	removeKeyboard(c.bot, c.chatID, c.session.lastTgMsgID)
+
+	c.session.lastTgMsgID = 0
+}
+
+// rejectStale answers a press of a button that isn't live. The
+// buttons are taken off that message, and the menu shown again if the chat
+// has no screen left to use.
+func (c *conversation) rejectStale() {
+	query := c.update.CallbackQuery
+
+	c.logger.Warn("Button on a stale message",
+		"data", query.Data,
+		"tgname", c.user.UserName)
+
+	c.callbackText = staleButtonText
+
+	if query.Message != nil {
+		removeKeyboard(c.bot, c.chatID, query.Message.MessageID)
+	}
+
+	if c.session.lastTgMsgID == 0 {
+		c.interrupt()
+		c.sendMenu()
+	}
+}
+
+// notify tells the user text as a toast for a button press, or as a message
+// otherwise.
+func (c *conversation) notify(text string) {
+	if c.isCallback() {
+		c.callbackText = text
+	} else {
+		c.send(text)
+	}
+}
+
+func removeKeyboard(bot Messenger, chatID int, messageID int) {
+	bot.Edit(tgbotapi.NewEditMessageReplyMarkup(int64(chatID), messageID,
+		tgbotapi.InlineKeyboardMarkup{
+			InlineKeyboard: [][]tgbotapi.InlineKeyboardButton{},
+		}))
+}
+
+// isNotModified tells Telegram's refusal to edit a message into what it
+// already says, which is fine by us.
+func isNotModified(err error) bool {
+	return strings.Contains(err.Error(), "message is not modified")
+}
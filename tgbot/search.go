@@ -0,0 +1,381 @@
+package tgbot
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"smOwd/animes"
+	"smOwd/misc"
+	"smOwd/subscriptions"
+
+	"github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+// searchPageSize is the number of results shown on one page of a search.
+const searchPageSize = 10
+
+const (
+	searchTimeout    = 10 * time.Minute
+	subscribeTimeout = time.Hour
+)
+
+func init() {
+	registerState(&state{
+		mode:    handleUpdateModeSearch,
+		name:    "Search",
+		timeout: searchTimeout,
+		transitions: []handleUpdateMode{
+			handleUpdateModeBasic,
+			handleUpdateModeSubscribe,
+			handleUpdateModeOffer,
+		},
+		enter: func(c *conversation) {
+			c.reply("Enter the name of the anime", nil)
+		},
+		handle: handleSearch,
+	})
+
+	registerState(&state{
+		mode:        handleUpdateModeSubscribe,
+		name:        "Subscribe",
+		timeout:     subscribeTimeout,
+		transitions: []handleUpdateMode{handleUpdateModeBasic},
+		enter:       (*conversation).showSearchPage,
+		handle:      handleSubscribe,
+	})
+}
+
+// handleSearch runs the search for the title the user typed.
+func handleSearch(c *conversation) handleUpdateMode {
+	c.session.searchQuery = c.text
+
+	err := fetchSearchPage(c.ctx, c.catalog, c.session, 1)
+
+	if err != nil {
+		c.logger.Error("Error searching for anime",
+			"Anime name", c.text,
+			"error", err)
+
+		c.send(catalogErrorText(err))
+
+		return handleUpdateModeBasic
+	} else if len(c.session.sliceAnime) == 0 {
+		c.logger.Warn("No animes found",
+			"Anime name", c.text)
+
+		c.send("No animes found")
+
+		return handleUpdateModeBasic
+	} else if len(c.session.sliceAnime) == 1 {
+		// Nothing to choose from, show its card instead
+		return handleUpdateModeOffer
+	}
+
+	return handleUpdateModeSubscribe
+}
+
+// handleSubscribe handles the buttons under the search results. Number
+// buttons tick results and Confirm subscribes to the ticked ones; typing
+// numbers like "1-4, 7" subscribes to those right away.
+func handleSubscribe(c *conversation) handleUpdateMode {
+	session := c.session
+
+	if !c.isCallback() {
+		return subscribeTyped(c)
+	}
+
+	switch c.callback.action {
+	case actionCancel:
+		return handleUpdateModeBasic
+	case actionPage:
+		turnSearchPage(c)
+		return handleUpdateModeSubscribe
+	case actionConfirm:
+		return subscribeSelected(c)
+	}
+
+	i := slices.IndexFunc(session.sliceAnime, func(a animes.Anime) bool {
+		return a.ShikiID == c.callback.id
+	})
+
+	if c.callback.action != actionToggle || i < 0 {
+		c.logger.Warn("Stale or unknown button", "data", c.text)
+
+		c.callbackText = staleButtonText
+
+		return handleUpdateModeBasic
+	}
+
+	anime := session.sliceAnime[i]
+
+	if session.toggle(anime.ShikiID) {
+		c.callbackText = "Selected " + anime.English
+	} else {
+		c.callbackText = "Unselected " + anime.English
+	}
+
+	c.showSearchPage()
+
+	return handleUpdateModeSubscribe
+}
+
+// subscribeTyped subscribes to the results numbered in the message.
+func subscribeTyped(c *conversation) handleUpdateMode {
+	session := c.session
+	offset := (session.searchPage - 1) * searchPageSize
+
+	ok, numbers := misc.ParseSelection(c.text)
+
+	var sliceAnime []animes.Anime
+
+	for _, n := range numbers {
+		if i := n - 1 - offset; i >= 0 && i < len(session.sliceAnime) {
+			sliceAnime = append(sliceAnime, session.sliceAnime[i])
+		} else {
+			ok = false
+		}
+	}
+
+	if !ok {
+		c.logger.Warn("No button pressed")
+
+		c.send("Press a button or type the numbers of the results, " +
+			"e.g. 1-4, 7")
+
+		c.showSearchPage()
+
+		return handleUpdateModeSubscribe
+	}
+
+	subscribeAll(c, sliceAnime)
+
+	return handleUpdateModeBasic
+}
+
+// subscribeSelected subscribes to the ticked results, which may be on other
+// pages than the one shown.
+func subscribeSelected(c *conversation) handleUpdateMode {
+	if len(c.session.selected) == 0 {
+		c.callbackText = "Nothing selected"
+		return handleUpdateModeSubscribe
+	}
+
+	var shikiIDs []string
+
+	for id := range c.session.selected {
+		shikiIDs = append(shikiIDs, id)
+	}
+
+	slices.Sort(shikiIDs)
+
+	sliceAnime, err := c.catalog.SearchAnimeByShikiIDs(c.ctx, shikiIDs)
+
+	if err != nil {
+		c.logger.Error("Error searching animes by ids",
+			"IDs", shikiIDs,
+			"error", err)
+
+		c.callbackText = catalogErrorText(err)
+
+		return handleUpdateModeSubscribe
+	}
+
+	subscribeAll(c, sliceAnime)
+
+	return handleUpdateModeBasic
+}
+
+func subscribeAll(c *conversation, sliceAnime []animes.Anime) {
+	var lines []string
+
+	for _, a := range sliceAnime {
+		lines = append(lines, subscribe(c, a))
+	}
+
+	c.reply(strings.Join(lines, "\n"), nil)
+}
+
+func turnSearchPage(c *conversation) {
+	session := c.session
+
+	page, err := c.callback.intID()
+
+	if err != nil || page < 1 {
+		c.logger.Warn("Stale or unknown button", "data", c.text)
+
+		c.callbackText = staleButtonText
+
+		return
+	}
+
+	sliceAnime, searchPage := session.sliceAnime, session.searchPage
+
+	err = fetchSearchPage(c.ctx, c.catalog, session, page)
+
+	if err != nil {
+		c.logger.Error("Error searching for anime",
+			"Anime name", session.searchQuery,
+			"Page", page,
+			"error", err)
+
+		c.callbackText = catalogErrorText(err)
+	} else if len(session.sliceAnime) == 0 {
+		// Past the last page, stay where we are
+		session.sliceAnime, session.searchPage = sliceAnime, searchPage
+		c.callbackText = "No more results"
+	} else {
+		c.showSearchPage()
+		c.callbackText = fmt.Sprintf("Page %d", session.searchPage)
+	}
+}
+
+// subscribe subscribes the user to anime unless they already are, and
+// returns a line telling them which it was.
+func subscribe(c *conversation, anime animes.Anime) string {
+	user := c.user
+
+	c.logger.Info("Selected anime",
+		"Anime name", anime.English)
+
+	subscription := c.subscriptionStore.Find(c.ctx,
+		user.TelegramID, anime.ShikiID)
+
+	if subscription != nil {
+		c.logger.Warn("Subscription already exists",
+			"Telegram ID", user.TelegramID,
+			"Shiki ID", anime.ShikiID)
+
+		return fmt.Sprintf("You are already subscribed to %s", anime.English)
+	} else if anime.Status == "released" {
+		return fmt.Sprintf("%s is already released", anime.English)
+	}
+
+	subscription = &subscriptions.Subscription{
+		ID:                  -1,
+		TelegramID:          user.TelegramID,
+		ShikiID:             anime.ShikiID,
+		LastEpisodeNotified: anime.EpisodesAired,
+	}
+
+	c.logger.Info("Adding subscription to db",
+		"Telegram ID", user.TelegramID,
+		"Anime name", anime.English)
+
+	subscription_id, err := c.subscriptionStore.Add(c.ctx, *subscription)
+
+	if err != nil {
+		c.logger.Fatal("Error adding subscription to db",
+			"Telegram ID", user.TelegramID,
+			"Anime name", anime.English,
+			"error", err)
+	}
+
+	subscription.ID = subscription_id
+
+	c.logger.Info("Added subscriptions to db",
+		"Telegram ID", user.TelegramID,
+		"Anime name", anime.English,
+		"Subscription ID", subscription.ID)
+
+	return fmt.Sprintf("You are now subscribed to %s", anime.English)
+}
+
+// fetchSearchPage loads page of the session's search query into
+// session.sliceAnime and remembers the page.
+func fetchSearchPage(ctx context.Context, catalog animes.AnimeSource,
+	session *sessionData, page int) error {
+	sliceAnime, err := catalog.SearchAnimeByName(ctx, session.searchQuery,
+		animes.SearchOptions{Page: page, Limit: searchPageSize})
+
+	if err != nil {
+		return err
+	}
+
+	session.sliceAnime = sliceAnime
+	session.searchPage = page
+
+	return nil
+}
+
+// searchPageMessage renders the current page of search results: one line
+// and one button per anime, Prev/Next buttons and Cancel.
+func searchPageMessage(session *sessionData) (string,
+	tgbotapi.InlineKeyboardMarkup) {
+	offset := (session.searchPage - 1) * searchPageSize
+
+	msgText := fmt.Sprintf("Results for \"%s\", page %d:\n\n",
+		session.searchQuery, session.searchPage)
+
+	var keyboard [][]tgbotapi.InlineKeyboardButton
+	var buttons []tgbotapi.InlineKeyboardButton
+
+	for i, anime := range session.sliceAnime {
+		msgText += strconv.Itoa(offset+i+1) + ". " + anime.English + " / " + anime.URL + "\n"
+
+		if anime.Status == "released" {
+			msgText += " / RELEASED!\n\n"
+			continue
+		}
+
+		msgText += "\n"
+
+		buttons = append(buttons, checkboxButton(strconv.Itoa(offset+i+1),
+			session.callback(actionToggle, anime.ShikiID),
+			session.selected[anime.ShikiID]))
+
+		if len(buttons) > 4 {
+			keyboard = append(keyboard, buttons)
+			buttons = []tgbotapi.InlineKeyboardButton{}
+		}
+	}
+
+	if len(buttons) > 0 {
+		keyboard = append(keyboard, buttons)
+	}
+
+	msgText += selectionHint
+
+	var navigation []tgbotapi.InlineKeyboardButton
+
+	if session.searchPage > 1 {
+		navigation = append(navigation,
+			tgbotapi.NewInlineKeyboardButtonData("« Prev",
+				session.callback(actionPage, strconv.Itoa(session.searchPage-1))))
+	}
+
+	// A short page is the last one. A full one may be too, which Next
+	// then finds out
+	if len(session.sliceAnime) == searchPageSize {
+		navigation = append(navigation,
+			tgbotapi.NewInlineKeyboardButtonData("Next »",
+				session.callback(actionPage, strconv.Itoa(session.searchPage+1))))
+	}
+
+	if len(navigation) > 0 {
+		keyboard = append(keyboard, navigation)
+	}
+
+	if len(session.selected) > 0 {
+		keyboard = append(keyboard, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(
+				fmt.Sprintf("Subscribe to %d selected", len(session.selected)),
+				session.callback(actionConfirm, ""))))
+	}
+
+	keyboard = append(keyboard, tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("Cancel",
+			session.callback(actionCancel, ""))))
+
+	return msgText, tgbotapi.NewInlineKeyboardMarkup(keyboard...)
+}
+
+// showSearchPage shows the current page of results as the chat's screen.
+func (c *conversation) showSearchPage() {
+	msgText, keyboard := searchPageMessage(c.session)
+
+	c.reply(msgText, &keyboard)
+}
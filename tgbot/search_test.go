@@ -0,0 +1,125 @@
+package tgbot
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+
+	"smOwd/animes"
+	"smOwd/logs"
+	"smOwd/tgbot/tgfake"
+	"smOwd/users"
+)
+
+func TestSearchPageNavigation(t *testing.T) {
+	tests := []struct {
+		page, results      int
+		wantPrev, wantNext bool
+	}{
+		{1, searchPageSize, false, true},
+		{1, 3, false, false},
+		{2, searchPageSize, true, true},
+		{2, searchPageSize - 1, true, false},
+		{3, 1, true, false},
+	}
+
+	for _, tt := range tests {
+		session := &sessionData{searchQuery: "x", searchPage: tt.page}
+		session.renewNonce()
+
+		for i := range tt.results {
+			session.sliceAnime = append(session.sliceAnime,
+				animes.Anime{ShikiID: strconv.Itoa(i + 1)})
+		}
+
+		_, keyboard := searchPageMessage(session)
+
+		var prev, next bool
+
+		for _, row := range keyboard.InlineKeyboard {
+			for _, button := range row {
+				data, err := decodeCallback(*button.CallbackData)
+				if err != nil || data.action != actionPage {
+					continue
+				}
+
+				switch data.id {
+				case strconv.Itoa(tt.page - 1):
+					prev = true
+				case strconv.Itoa(tt.page + 1):
+					next = true
+				}
+			}
+		}
+
+		if prev != tt.wantPrev || next != tt.wantNext {
+			t.Errorf("page %d with %d results: prev %v, next %v, want %v, %v",
+				tt.page, tt.results, prev, next, tt.wantPrev, tt.wantNext)
+		}
+	}
+}
+
+// errorSource fails every lookup with err.
+type errorSource struct {
+	animes.AnimeSource
+	err error
+}
+
+func (s errorSource) SearchAnimeByName(ctx context.Context, name string,
+	opts animes.SearchOptions) ([]animes.Anime, error) {
+	return nil, s.err
+}
+
+func TestHandleSearchCatalogErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{"unreachable", &animes.NetworkError{Err: errors.New("refused")},
+			catalogUnavailableText},
+		{"overloaded", &animes.StatusError{StatusCode: 503},
+			catalogUnavailableText},
+		{"rate limited", &animes.NetworkError{Err: animes.ErrRateLimited},
+			catalogUnavailableText},
+		{"bad request", &animes.StatusError{StatusCode: 400}, catalogFailedText},
+		{"graphql", &animes.GraphQLError{Messages: []string{"bad field"}},
+			catalogFailedText},
+	}
+
+	for _, tt := range tests {
+		fake := tgfake.New()
+		ts := fake.Start()
+
+		api, err := tgfake.NewBotAPI(ts, "token")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ctx := context.Background()
+
+		c := &conversation{
+			ctx:     ctx,
+			logger:  logs.DefaultFromCtx(ctx),
+			bot:     NewMessenger(api),
+			catalog: errorSource{err: tt.err},
+			user:    &users.User{},
+			chatID:  1,
+			session: &sessionData{handleUpdateModeField: handleUpdateModeSearch},
+			text:    "frieren",
+		}
+
+		if next := handleSearch(c); next != handleUpdateModeBasic {
+			t.Errorf("%s: next state %v, want Basic", tt.name, next)
+		}
+
+		calls := fake.CallsTo("sendMessage")
+
+		if len(calls) != 1 || calls[0].Text() != tt.want {
+			t.Errorf("%s: sent %v, want %q", tt.name, calls, tt.want)
+		}
+
+		ts.Close()
+	}
+}
@@ -0,0 +1,192 @@
+package tgbot
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"smOwd/animes"
+	"smOwd/logs"
+	"smOwd/sessions"
+	"smOwd/subscriptions"
+	"smOwd/users"
+)
+
+// loadSession restores the user's session from the store and re-fetches the
+// animes and subscriptions its buttons refer to, so button presses keep
+// working across restarts. Users without a session start in Init mode.
+func loadSession(ctx context.Context, store sessions.SessionStore,
+	subscriptionStore subscriptions.SubscriptionStore,
+	catalog animes.AnimeSource, user *users.User) *sessionData {
+	logger := logs.DefaultFromCtx(ctx)
+
+	session := &sessionData{handleUpdateModeField: handleUpdateModeInit}
+
+	stored, err := store.Load(ctx, user.ID)
+
+	if err != nil {
+		logger.Error("Error loading session", "User ID", user.ID, "error", err)
+		return session
+	} else if stored == nil {
+		logger.Info("Starting new session", "User ID", user.ID)
+		return session
+	}
+
+	session.handleUpdateModeField = handleUpdateMode(stored.Mode)
+	session.searchQuery = stored.SearchQuery
+	session.searchPage = stored.SearchPage
+	session.lastTgMsgID = stored.LastMessageID
+	session.nonce = stored.Nonce
+	session.updatedAt = stored.UpdatedAt
+
+	for _, id := range stored.Selected {
+		session.toggle(id)
+	}
+
+	if len(stored.SubscriptionIDs) > 0 {
+		mapSubscriptions := make(map[int]subscriptions.Subscription)
+
+		for _, s := range subscriptionStore.FindAll(ctx, user.TelegramID) {
+			mapSubscriptions[s.ID] = s
+		}
+
+		var sliceSubscriptions []subscriptions.Subscription
+		var shikiIDs []string
+
+		for _, id := range stored.SubscriptionIDs {
+			if s, ok := mapSubscriptions[id]; ok {
+				sliceSubscriptions = append(sliceSubscriptions, s)
+				shikiIDs = append(shikiIDs, s.ShikiID)
+			}
+		}
+
+		if len(sliceSubscriptions) != len(stored.SubscriptionIDs) {
+			// Buttons would point at the wrong subscriptions
+			logger.Warn("Session subscriptions changed, resetting",
+				"User ID", user.ID)
+			return resetSession(session)
+		}
+
+		sliceAnime, err := catalog.SearchAnimeByShikiIDs(ctx, shikiIDs)
+
+		if err != nil {
+			logger.Warn("Error restoring session animes, resetting",
+				"User ID", user.ID,
+				"error", err)
+			return resetSession(session)
+		}
+
+		attachAnimes(ctx, session, sliceSubscriptions, sliceAnime)
+	} else if len(stored.AnimeIDs) > 0 {
+		sliceAnime, err := catalog.SearchAnimeByShikiIDs(ctx, stored.AnimeIDs)
+
+		if err != nil {
+			logger.Warn("Error restoring session animes, resetting",
+				"User ID", user.ID,
+				"error", err)
+			return resetSession(session)
+		}
+
+		session.sliceAnime = orderByShikiIDs(stored.AnimeIDs, sliceAnime)
+	}
+
+	return session
+}
+
+func resetSession(session *sessionData) *sessionData {
+	session.clear()
+	session.handleUpdateModeField = handleUpdateModeBasic
+	return session
+}
+
+func saveSession(ctx context.Context, store sessions.SessionStore, userID int,
+	session *sessionData) {
+	logger := logs.DefaultFromCtx(ctx)
+
+	stored := &sessions.Session{
+		UserID:        userID,
+		Mode:          int(session.handleUpdateModeField),
+		SearchQuery:   session.searchQuery,
+		SearchPage:    session.searchPage,
+		LastMessageID: session.lastTgMsgID,
+		Nonce:         session.nonce,
+		UpdatedAt:     time.Now(),
+	}
+
+	if session.handleUpdateModeField == handleUpdateModeBasic {
+		// Basic mode starts from a clean session, nothing to restore
+		stored.SearchQuery = ""
+		stored.SearchPage = 0
+	} else if len(session.sliceSubscriptions) > 0 {
+		for _, s := range session.sliceSubscriptions {
+			stored.SubscriptionIDs = append(stored.SubscriptionIDs, s.ID)
+		}
+	} else {
+		for _, a := range session.sliceAnime {
+			stored.AnimeIDs = append(stored.AnimeIDs, a.ShikiID)
+		}
+	}
+
+	if session.handleUpdateModeField != handleUpdateModeBasic {
+		for id := range session.selected {
+			stored.Selected = append(stored.Selected, id)
+		}
+		slices.Sort(stored.Selected)
+	}
+
+	if err := store.Save(ctx, stored); err != nil {
+		logger.Error("Error saving session", "User ID", userID, "error", err)
+	}
+}
+
+// attachAnimes stores sliceSubscriptions in the session with their animes
+// attached, and the animes in the same order as session.sliceAnime.
+func attachAnimes(ctx context.Context, session *sessionData,
+	sliceSubscriptions []subscriptions.Subscription, sliceAnime []animes.Anime) {
+	logger := logs.DefaultFromCtx(ctx)
+
+	mapAnime := make(map[string]animes.Anime, len(sliceAnime))
+
+	for _, a := range sliceAnime {
+		mapAnime[a.ShikiID] = a
+	}
+
+	session.sliceSubscriptions = sliceSubscriptions
+	session.sliceAnime = []animes.Anime{}
+
+	for i, s := range session.sliceSubscriptions {
+		a, ok := mapAnime[s.ShikiID]
+
+		if !ok {
+			logger.Warn("Subscription anime not found in catalog",
+				"Shiki ID", s.ShikiID)
+
+			a = animes.Anime{ShikiID: s.ShikiID, English: s.ShikiID}
+		}
+
+		session.sliceSubscriptions[i].Anime = &a
+		session.sliceAnime = append(session.sliceAnime, a)
+	}
+}
+
+// orderByShikiIDs returns sliceAnime in the order of shikiIDs, keeping a
+// placeholder for ids the catalog no longer knows so positions stay put.
+func orderByShikiIDs(shikiIDs []string, sliceAnime []animes.Anime) []animes.Anime {
+	mapAnime := make(map[string]animes.Anime, len(sliceAnime))
+
+	for _, a := range sliceAnime {
+		mapAnime[a.ShikiID] = a
+	}
+
+	result := make([]animes.Anime, 0, len(shikiIDs))
+
+	for _, id := range shikiIDs {
+		a, ok := mapAnime[id]
+		if !ok {
+			a = animes.Anime{ShikiID: id, English: id}
+		}
+		result = append(result, a)
+	}
+
+	return result
+}
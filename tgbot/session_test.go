@@ -0,0 +1,200 @@
+package tgbot
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"smOwd/animes"
+	"smOwd/animes/shikifake"
+	"smOwd/sessions"
+	"smOwd/subscriptions"
+	"smOwd/tgbot/tgfake"
+	"smOwd/users"
+
+	"github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+// jsonStore keeps sessions the way the sessions table does, as JSON, so
+// only what survives encoding is restored.
+type jsonStore struct {
+	*sessions.MemoryStore
+}
+
+func (s jsonStore) Save(ctx context.Context, session *sessions.Session) error {
+	data, err := json.Marshal(session)
+	if err != nil {
+		return err
+	}
+
+	var decoded sessions.Session
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+	decoded.UserID = session.UserID
+
+	return s.MemoryStore.Save(ctx, &decoded)
+}
+
+// restartingBot handles every update as if the bot had just been started:
+// only the stores are kept, the bot connection and catalog client are new.
+type restartingBot struct {
+	t             *testing.T
+	fake          *tgfake.Server
+	shikiURL      string
+	users         *users.MemoryStore
+	subscriptions *subscriptions.MemoryStore
+	sessions      jsonStore
+	connect       func() (*tgbotapi.BotAPI, error)
+}
+
+func newRestartingBot(t *testing.T) *restartingBot {
+	fake := tgfake.New()
+	ts := fake.Start()
+	t.Cleanup(ts.Close)
+
+	shiki := shikifake.New(testAnimes).Start()
+	t.Cleanup(shiki.Close)
+
+	userStore := users.NewMemoryStore()
+
+	return &restartingBot{
+		t:             t,
+		fake:          fake,
+		shikiURL:      shiki.URL,
+		users:         userStore,
+		subscriptions: subscriptions.NewMemoryStore(userStore),
+		sessions:      jsonStore{sessions.NewMemoryStore(time.Hour)},
+		connect: func() (*tgbotapi.BotAPI, error) {
+			return tgfake.NewBotAPI(ts, "token")
+		},
+	}
+}
+
+func (b *restartingBot) handle(update tgbotapi.Update) {
+	b.t.Helper()
+
+	api, err := b.connect()
+	if err != nil {
+		b.t.Fatal(err)
+	}
+
+	handleUpdate(context.Background(), NewMessenger(api), update, b.users,
+		b.subscriptions, animes.NewShikimori(b.shikiURL), b.sessions)
+}
+
+func (b *restartingBot) sendMessage(text string) {
+	msg := &tgbotapi.Message{
+		From: &tgbotapi.User{ID: testUserID, FirstName: "User"},
+		Chat: &tgbotapi.Chat{ID: testChatID, Type: "private"},
+		Text: text,
+	}
+
+	if strings.HasPrefix(text, "/") {
+		msg.Entities = &[]tgbotapi.MessageEntity{
+			{Type: "bot_command", Length: len(strings.Fields(text)[0])},
+		}
+	}
+
+	b.handle(tgbotapi.Update{Message: msg})
+}
+
+func (b *restartingBot) pressButton(messageID int, data string) {
+	b.handle(tgbotapi.Update{CallbackQuery: &tgbotapi.CallbackQuery{
+		ID:   "1",
+		From: &tgbotapi.User{ID: testUserID, FirstName: "User"},
+		Message: &tgbotapi.Message{
+			MessageID: messageID,
+			Chat:      &tgbotapi.Chat{ID: testChatID, Type: "private"},
+		},
+		Data: data,
+	}})
+}
+
+// last returns the last call to method.
+func (b *restartingBot) last(method string) tgfake.Call {
+	b.t.Helper()
+
+	calls := b.fake.CallsTo(method)
+	if len(calls) == 0 {
+		b.t.Fatalf("no %s calls", method)
+	}
+	return calls[len(calls)-1]
+}
+
+func TestSubscribeSurvivesRestart(t *testing.T) {
+	b := newRestartingBot(t)
+	tb := &testBot{t: t}
+
+	b.sendMessage("/search frieren")
+
+	results := b.last("sendMessage")
+	screen := results.SentMessageID
+
+	b.pressButton(screen, tb.button(results.Keyboard(), actionToggle, "102"))
+
+	ticked := b.last("editMessageText")
+	if !strings.Contains(ticked.Params.Get("reply_markup"), "☑ 2") {
+		t.Fatalf("after the restart 2 isn't ticked: %s",
+			ticked.Params.Get("reply_markup"))
+	}
+
+	b.pressButton(screen, tb.button(ticked.Keyboard(), actionConfirm, ""))
+
+	if text := b.last("editMessageText").Text(); text !=
+		"You are now subscribed to Frieren Beta" {
+		t.Errorf("confirm after the restart replied %q", text)
+	}
+
+	if b.subscriptions.Find(context.Background(), testUserID, "102") == nil {
+		t.Error("not subscribed to 102")
+	}
+}
+
+func TestRemoveSurvivesRestart(t *testing.T) {
+	b := newRestartingBot(t)
+	tb := &testBot{t: t}
+	ctx := context.Background()
+
+	for _, shikiID := range []string{"101", "102"} {
+		b.subscriptions.Add(ctx, subscriptions.Subscription{
+			TelegramID: testUserID,
+			ShikiID:    shikiID,
+		})
+	}
+
+	b.sendMessage("/unsubscribe")
+
+	list := b.last("sendMessage")
+	screen := list.SentMessageID
+
+	beta := b.subscriptions.Find(ctx, testUserID, "102")
+
+	b.pressButton(screen, tb.button(list.Keyboard(), actionToggle,
+		strconv.Itoa(beta.ID)))
+	b.pressButton(screen, tb.button(b.last("editMessageText").Keyboard(),
+		actionConfirm, ""))
+
+	if text := b.last("editMessageText").Text(); text !=
+		"You are unsubscribed from Frieren Beta" {
+		t.Errorf("confirm after the restart replied %q", text)
+	}
+
+	left := b.subscriptions.FindAll(ctx, testUserID)
+	if len(left) != 1 || left[0].ShikiID != "101" {
+		t.Errorf("subscriptions left %v, want 101 only", left)
+	}
+
+	// A button of the finished flow is stale, even after a restart
+	b.pressButton(screen, tb.button(list.Keyboard(), actionToggle,
+		strconv.Itoa(beta.ID)))
+
+	answer := b.last("answerCallbackQuery")
+
+	if text := answer.Params.Get("text"); text != staleButtonText {
+		t.Errorf("old button answered %q, want it stale", text)
+	}
+}
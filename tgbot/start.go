@@ -0,0 +1,17 @@
+package tgbot
+
+func init() {
+	registerState(&state{
+		mode:        handleUpdateModeInit,
+		name:        "Init",
+		transitions: []handleUpdateMode{handleUpdateModeBasic},
+		handle:      handleInit,
+	})
+}
+
+// handleInit greets users the bot hasn't talked to yet.
+func handleInit(c *conversation) handleUpdateMode {
+	c.send("Started!")
+
+	return handleUpdateModeBasic
+}
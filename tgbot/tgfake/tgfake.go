@@ -0,0 +1,364 @@
+// Package tgfake is an in-process stand-in for the Telegram Bot API. It
+// records every call the bot makes, answers them with plausible results and
+// feeds the bot updates injected by the caller through getUpdates, so chat
+// conversations can be scripted without Telegram:
+//
+//	fake := tgfake.New()
+//	ts := fake.Start()
+//	bot, _ := tgfake.NewBotAPI(ts, "token")
+//	// run the bot with bot ...
+//	fake.SendMessage(42, 7, "/search frieren")
+//	calls, ok := fake.WaitForCalls("sendMessage", 1, time.Second)
+package tgfake
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+// maxPoll caps how long getUpdates waits for new updates, whatever timeout
+// the bot asks for, so bots under test stop promptly.
+const maxPoll = time.Second
+
+// Self is the user getMe returns.
+var Self = tgbotapi.User{
+	ID:        1,
+	IsBot:     true,
+	FirstName: "Fake",
+	UserName:  "fake_bot",
+}
+
+// Call is one Bot API request made by the bot.
+type Call struct {
+	Method string
+	Params url.Values
+
+	// SentMessageID is the id of the message sendMessage or sendPhoto
+	// created, for pressing its buttons
+	SentMessageID int
+}
+
+func (c Call) ChatID() int64 {
+	id, _ := strconv.ParseInt(c.Params.Get("chat_id"), 10, 64)
+	return id
+}
+
+func (c Call) MessageID() int {
+	id, _ := strconv.Atoi(c.Params.Get("message_id"))
+	return id
+}
+
+// Text is the text or caption of the call.
+func (c Call) Text() string {
+	if text := c.Params.Get("text"); text != "" {
+		return text
+	}
+	return c.Params.Get("caption")
+}
+
+// Keyboard decodes the inline keyboard attached to the call, if any.
+func (c Call) Keyboard() *tgbotapi.InlineKeyboardMarkup {
+	var keyboard tgbotapi.InlineKeyboardMarkup
+
+	if err := json.Unmarshal([]byte(c.Params.Get("reply_markup")), &keyboard); err != nil {
+		return nil
+	}
+	return &keyboard
+}
+
+type Server struct {
+	mu            sync.Mutex
+	calls         []Call
+	updates       []tgbotapi.Update
+	nextUpdateID  int
+	nextMessageID int
+	nextCallback  int
+	// changed is closed and replaced whenever calls or updates change
+	changed chan struct{}
+}
+
+func New() *Server {
+	return &Server{
+		nextUpdateID:  1,
+		nextMessageID: 1,
+		changed:       make(chan struct{}),
+	}
+}
+
+// Start serves the fake on a local httptest server. Bots reach it through
+// Client or NewBotAPI.
+func (s *Server) Start() *httptest.Server {
+	return httptest.NewServer(s)
+}
+
+// Client returns an HTTP client sending requests for api.telegram.org to ts.
+func Client(ts *httptest.Server) *http.Client {
+	target, _ := url.Parse(ts.URL)
+
+	return &http.Client{Transport: &rewriteTransport{target: target}}
+}
+
+// NewBotAPI returns a BotAPI talking to ts.
+func NewBotAPI(ts *httptest.Server, token string) (*tgbotapi.BotAPI, error) {
+	return tgbotapi.NewBotAPIWithClient(token, Client(ts))
+}
+
+type rewriteTransport struct {
+	target *url.URL
+}
+
+func (t *rewriteTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	r = r.Clone(r.Context())
+	r.URL.Scheme = t.target.Scheme
+	r.URL.Host = t.target.Host
+	r.Host = t.target.Host
+
+	return http.DefaultTransport.RoundTrip(r)
+}
+
+// PushUpdate queues update for the bot's next getUpdates and returns its
+// update id.
+func (s *Server) PushUpdate(update tgbotapi.Update) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	update.UpdateID = s.nextUpdateID
+	s.nextUpdateID++
+
+	s.updates = append(s.updates, update)
+	s.notify()
+
+	return update.UpdateID
+}
+
+// SendMessage queues a text message from userID in chatID. Text starting
+// with a slash is marked as a command like Telegram does.
+func (s *Server) SendMessage(chatID int64, userID int, text string) int {
+	msg := &tgbotapi.Message{
+		MessageID: s.newMessageID(),
+		From:      &tgbotapi.User{ID: userID, FirstName: "User"},
+		Date:      int(time.Now().Unix()),
+		Chat:      &tgbotapi.Chat{ID: chatID, Type: "private"},
+		Text:      text,
+	}
+
+	if strings.HasPrefix(text, "/") {
+		length := strings.IndexAny(text, " \n")
+		if length < 0 {
+			length = len(text)
+		}
+
+		msg.Entities = &[]tgbotapi.MessageEntity{
+			{Type: "bot_command", Offset: 0, Length: length},
+		}
+	}
+
+	return s.PushUpdate(tgbotapi.Update{Message: msg})
+}
+
+// PressButton queues a press of the button with data on the bot's message
+// messageID in chatID.
+func (s *Server) PressButton(chatID int64, userID int, messageID int,
+	data string) int {
+	s.mu.Lock()
+	s.nextCallback++
+	callbackID := strconv.Itoa(s.nextCallback)
+	s.mu.Unlock()
+
+	return s.PushUpdate(tgbotapi.Update{
+		CallbackQuery: &tgbotapi.CallbackQuery{
+			ID:   callbackID,
+			From: &tgbotapi.User{ID: userID, FirstName: "User"},
+			Message: &tgbotapi.Message{
+				MessageID: messageID,
+				From:      &Self,
+				Chat:      &tgbotapi.Chat{ID: chatID, Type: "private"},
+			},
+			Data: data,
+		},
+	})
+}
+
+// SendInlineQuery queues "@bot query" typed by userID in some chat.
+func (s *Server) SendInlineQuery(userID int, query string, offset string) int {
+	s.mu.Lock()
+	s.nextCallback++
+	queryID := strconv.Itoa(s.nextCallback)
+	s.mu.Unlock()
+
+	return s.PushUpdate(tgbotapi.Update{
+		InlineQuery: &tgbotapi.InlineQuery{
+			ID:     queryID,
+			From:   &tgbotapi.User{ID: userID, FirstName: "User"},
+			Query:  query,
+			Offset: offset,
+		},
+	})
+}
+
+// Calls returns every call received so far, getMe and getUpdates aside.
+func (s *Server) Calls() []Call {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]Call(nil), s.calls...)
+}
+
+// CallsTo returns the calls to method received so far.
+func (s *Server) CallsTo(method string) []Call {
+	var result []Call
+
+	for _, c := range s.Calls() {
+		if c.Method == method {
+			result = append(result, c)
+		}
+	}
+	return result
+}
+
+// WaitForCalls waits until at least n calls to method were received and
+// returns them. It reports false if that didn't happen within timeout.
+func (s *Server) WaitForCalls(method string, n int,
+	timeout time.Duration) ([]Call, bool) {
+	deadline := time.After(timeout)
+
+	for {
+		s.mu.Lock()
+		changed := s.changed
+		s.mu.Unlock()
+
+		if calls := s.CallsTo(method); len(calls) >= n {
+			return calls, true
+		}
+
+		select {
+		case <-changed:
+		case <-deadline:
+			return s.CallsTo(method), false
+		}
+	}
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// Requests look like /bot<token>/<method>
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/"), "/")
+
+	if len(parts) != 2 || !strings.HasPrefix(parts[0], "bot") {
+		http.NotFound(w, r)
+		return
+	}
+
+	err := r.ParseMultipartForm(32 << 20)
+	if err != nil && err != http.ErrNotMultipart {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	call := Call{Method: parts[1], Params: r.Form}
+
+	var result interface{}
+
+	switch call.Method {
+	case "getMe":
+		result = Self
+	case "getUpdates":
+		result = s.waitForUpdates(r, call.Params)
+	case "sendMessage", "sendPhoto":
+		call.SentMessageID = s.newMessageID()
+		s.record(call)
+		result = s.message(call, call.SentMessageID)
+	case "editMessageText", "editMessageCaption", "editMessageReplyMarkup":
+		s.record(call)
+		result = s.message(call, call.MessageID())
+	default:
+		// answerCallbackQuery, deleteMessage, setWebhook, setMyCommands...
+		s.record(call)
+		result = true
+	}
+
+	data, _ := json.Marshal(result)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tgbotapi.APIResponse{Ok: true, Result: data})
+}
+
+func (s *Server) record(call Call) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.calls = append(s.calls, call)
+	s.notify()
+}
+
+// notify wakes up waiters; s.mu must be held.
+func (s *Server) notify() {
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+func (s *Server) newMessageID() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id := s.nextMessageID
+	s.nextMessageID++
+	return id
+}
+
+func (s *Server) message(call Call, messageID int) tgbotapi.Message {
+	return tgbotapi.Message{
+		MessageID: messageID,
+		From:      &Self,
+		Date:      int(time.Now().Unix()),
+		Chat:      &tgbotapi.Chat{ID: call.ChatID(), Type: "private"},
+		Text:      call.Params.Get("text"),
+		Caption:   call.Params.Get("caption"),
+	}
+}
+
+// waitForUpdates returns the queued updates from offset on, waiting a
+// little for some to arrive like Telegram's long polling does.
+func (s *Server) waitForUpdates(r *http.Request,
+	params url.Values) []tgbotapi.Update {
+	offset, _ := strconv.Atoi(params.Get("offset"))
+
+	timeout := maxPoll
+	if seconds, err := strconv.Atoi(params.Get("timeout")); err == nil &&
+		time.Duration(seconds)*time.Second < timeout {
+		timeout = time.Duration(seconds) * time.Second
+	}
+
+	deadline := time.After(timeout)
+
+	for {
+		s.mu.Lock()
+		var result []tgbotapi.Update
+		for _, u := range s.updates {
+			if u.UpdateID >= offset {
+				result = append(result, u)
+			}
+		}
+		changed := s.changed
+		s.mu.Unlock()
+
+		if len(result) > 0 {
+			return result
+		}
+
+		select {
+		case <-changed:
+		case <-deadline:
+			return []tgbotapi.Update{}
+		case <-r.Context().Done():
+			return []tgbotapi.Update{}
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package tgbot
+
+import (
+	"strconv"
+	"time"
+
+	"smOwd/animes"
+	"smOwd/subscriptions"
+
+	"github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+const unsubscribeTimeout = time.Hour
+
+func init() {
+	registerState(&state{
+		mode:        handleUpdateModeUnsubscribe,
+		name:        "Unsubscribe",
+		timeout:     unsubscribeTimeout,
+		transitions: []handleUpdateMode{handleUpdateModeBasic},
+		enter:       (*conversation).showUnsubscribe,
+		handle:      handleUnsubscribe,
+	})
+}
+
+// confirmUnsubscribe asks whether to drop s, e.g. for the Unsubscribe link
+// of a notification. Links can be posted by anyone, so nothing is removed
+// until the user presses a button only their chat has. The conversation
+// must be in Basic.
+func (c *conversation) confirmUnsubscribe(s subscriptions.Subscription) {
+	c.session.sliceSubscriptions = []subscriptions.Subscription{s}
+	c.session.sliceAnime = []animes.Anime{*s.Anime}
+
+	c.transition(states[handleUpdateModeBasic], handleUpdateModeUnsubscribe)
+}
+
+// handleUnsubscribe handles the buttons under the Unsubscribe question.
+func handleUnsubscribe(c *conversation) handleUpdateMode {
+	session := c.session
+
+	if !c.isCallback() {
+		c.logger.Warn("No button pressed")
+
+		c.send("Don't text, press a button")
+
+		c.showUnsubscribe()
+
+		return handleUpdateModeUnsubscribe
+	} else if c.callback.action == actionCancel {
+		return handleUpdateModeBasic
+	}
+
+	id, err := c.callback.intID()
+
+	if c.callback.action != actionConfirm || err != nil ||
+		len(session.sliceSubscriptions) != 1 ||
+		session.sliceSubscriptions[0].ID != id {
+		c.logger.Warn("Stale or unknown button", "data", c.text)
+
+		c.callbackText = staleButtonText
+
+		return handleUpdateModeBasic
+	}
+
+	removeAll(c, session.sliceSubscriptions)
+
+	return handleUpdateModeBasic
+}
+
+// showUnsubscribe shows the card of the subscription's anime with the
+// question as the chat's screen.
+func (c *conversation) showUnsubscribe() {
+	if len(c.session.sliceSubscriptions) != 1 {
+		return
+	}
+
+	s := c.session.sliceSubscriptions[0]
+
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("Unsubscribe",
+			c.session.callback(actionConfirm, strconv.Itoa(s.ID))),
+		tgbotapi.NewInlineKeyboardButtonData("Cancel",
+			c.session.callback(actionCancel, ""))))
+
+	c.replyCard(*s.Anime, "Unsubscribe from this anime?", &keyboard)
+}
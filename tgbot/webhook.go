@@ -0,0 +1,204 @@
+package tgbot
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"smOwd/logs"
+
+	"github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+const (
+	modePolling = "polling"
+	modeWebhook = "webhook"
+)
+
+// defaultWebhookListen matches the port docker-compose exposes.
+const defaultWebhookListen = ":8080"
+
+// maxUpdateSize caps the body of a webhook request.
+const maxUpdateSize = 1 << 20
+
+// webhookConfig is read from the environment:
+//
+//	WEBHOOK_LISTEN    address to listen on, defaults to :8080
+//	WEBHOOK_URL       public base URL Telegram posts to, e.g.
+//	                  https://bot.example.com; when empty the webhook is
+//	                  expected to be registered already
+//	WEBHOOK_SECRET    path segment only Telegram knows, required; updates
+//	                  are served at /<secret>
+//	WEBHOOK_TLS_CERT  certificate and key files to serve HTTPS directly;
+//	WEBHOOK_TLS_KEY   leave empty behind a TLS terminating proxy
+type webhookConfig struct {
+	listen    string
+	publicURL string
+	secret    string
+	tlsCert   string
+	tlsKey    string
+}
+
+func webhookConfigFromEnv() webhookConfig {
+	config := webhookConfig{
+		listen:    os.Getenv("WEBHOOK_LISTEN"),
+		publicURL: strings.TrimSuffix(os.Getenv("WEBHOOK_URL"), "/"),
+		secret:    os.Getenv("WEBHOOK_SECRET"),
+		tlsCert:   os.Getenv("WEBHOOK_TLS_CERT"),
+		tlsKey:    os.Getenv("WEBHOOK_TLS_KEY"),
+	}
+
+	if config.listen == "" {
+		config.listen = defaultWebhookListen
+	}
+
+	return config
+}
+
+func (config webhookConfig) path() string {
+	return "/" + config.secret
+}
+
+// receiveUpdates starts delivering updates the way TELEGRAM_MODE says,
+// long polling by default.
+func receiveUpdates(ctx context.Context,
+	bot *tgbotapi.BotAPI) (tgbotapi.UpdatesChannel, error) {
+	logger := logs.DefaultFromCtx(ctx)
+
+	switch mode := os.Getenv("TELEGRAM_MODE"); mode {
+	case modeWebhook:
+		return serveWebhook(ctx, bot, webhookConfigFromEnv())
+	case "", modePolling:
+		return pollUpdates(ctx, bot)
+	default:
+		logger.Warn("Unknown TELEGRAM_MODE, using long polling", "mode", mode)
+		return pollUpdates(ctx, bot)
+	}
+}
+
+func pollUpdates(ctx context.Context,
+	bot *tgbotapi.BotAPI) (tgbotapi.UpdatesChannel, error) {
+	logger := logs.DefaultFromCtx(ctx)
+
+	// getUpdates is refused while a webhook is registered
+	if _, err := bot.RemoveWebhook(); err != nil {
+		logger.Warn("Failed to remove webhook", "error", err)
+	}
+
+	// Configure the update channel (long polling)
+	u := tgbotapi.NewUpdate(0)
+	u.Timeout = 160
+
+	logger.Info("Receiving updates by long polling")
+
+	// Get updates (messages and callback queries) from Telegram
+	return bot.GetUpdatesChan(u)
+}
+
+// serveWebhook registers the webhook with Telegram and serves it until ctx
+// is done. It refuses to without a secret: the handler would be mounted on
+// /, and anyone who can reach it could post updates as any user.
+func serveWebhook(ctx context.Context, bot *tgbotapi.BotAPI,
+	config webhookConfig) (tgbotapi.UpdatesChannel, error) {
+	logger := logs.DefaultFromCtx(ctx)
+
+	if config.secret == "" {
+		return nil, errors.New("WEBHOOK_SECRET must be set in webhook mode")
+	}
+
+	if config.publicURL != "" {
+		_, err := bot.SetWebhook(tgbotapi.NewWebhook(config.publicURL + config.path()))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	updates := make(chan tgbotapi.Update, bot.Buffer)
+
+	mux := http.NewServeMux()
+	mux.Handle(config.path(), newWebhookHandler(ctx, updates))
+
+	server := &http.Server{
+		Addr:              config.listen,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		var err error
+
+		if config.tlsCert != "" {
+			err = server.ListenAndServeTLS(config.tlsCert, config.tlsKey)
+		} else {
+			err = server.ListenAndServe()
+		}
+
+		if !errors.Is(err, http.ErrServerClosed) {
+			logger.Fatal("Webhook server stopped", "error", err)
+		}
+	}()
+
+	go func() {
+		<-ctx.Done()
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(),
+			5*time.Second)
+		defer cancel()
+
+		server.Shutdown(shutdownCtx)
+	}()
+
+	logger.Info("Receiving updates by webhook",
+		"listen", config.listen,
+		"tls", config.tlsCert != "")
+
+	return updates, nil
+}
+
+// webhookHandler decodes updates Telegram posts and hands them to the
+// update loop. Posting an update by hand works the same, e.g.
+//
+//	curl -d '{"update_id":1,"message":{...}}' localhost:8080/<secret>
+type webhookHandler struct {
+	ctx     context.Context
+	updates chan<- tgbotapi.Update
+}
+
+func newWebhookHandler(ctx context.Context,
+	updates chan<- tgbotapi.Update) *webhookHandler {
+	return &webhookHandler{ctx: ctx, updates: updates}
+}
+
+func (h *webhookHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	logger := logs.DefaultFromCtx(h.ctx)
+
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var update tgbotapi.Update
+
+	err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxUpdateSize)).
+		Decode(&update)
+
+	if err != nil {
+		logger.Warn("Failed to decode webhook update", "error", err)
+		http.Error(w, "bad update", http.StatusBadRequest)
+		return
+	}
+
+	select {
+	case h.updates <- update:
+		w.WriteHeader(http.StatusOK)
+	case <-r.Context().Done():
+		// Telegram retries updates it couldn't deliver
+	case <-h.ctx.Done():
+		http.Error(w, "shutting down", http.StatusServiceUnavailable)
+	}
+}
@@ -0,0 +1,80 @@
+package tgbot
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+func TestServeWebhookRequiresSecret(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	updates, err := serveWebhook(ctx, nil, webhookConfig{listen: "127.0.0.1:0"})
+
+	if err == nil || updates != nil {
+		t.Fatalf("serveWebhook without a secret = %v, %v, want an error",
+			updates, err)
+	}
+}
+
+func TestWebhookHandler(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	updates := make(chan tgbotapi.Update, 1)
+	server := httptest.NewServer(newWebhookHandler(ctx, updates))
+	defer server.Close()
+
+	resp, err := http.Post(server.URL, "application/json",
+		strings.NewReader(`{"update_id":7,"message":{"message_id":1,"text":"hi"}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("POST status %d, want 200", resp.StatusCode)
+	}
+
+	select {
+	case update := <-updates:
+		if update.UpdateID != 7 || update.Message == nil ||
+			update.Message.Text != "hi" {
+			t.Errorf("delivered %+v, want update 7", update)
+		}
+	default:
+		t.Error("POST delivered no update")
+	}
+
+	resp, err = http.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusMethodNotAllowed ||
+		resp.Header.Get("Allow") != http.MethodPost {
+		t.Errorf("GET status %d, Allow %q, want 405 and POST", resp.StatusCode,
+			resp.Header.Get("Allow"))
+	}
+
+	resp, err = http.Post(server.URL, "application/json",
+		strings.NewReader(`{"update_id":`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("bad body status %d, want 400", resp.StatusCode)
+	}
+
+	if len(updates) != 0 {
+		t.Error("a refused request delivered an update")
+	}
+}
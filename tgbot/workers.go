@@ -0,0 +1,105 @@
+package tgbot
+
+import (
+	"context"
+	"runtime/debug"
+	"sync"
+
+	"smOwd/logs"
+
+	"github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+// defaultUpdateWorkers is the number of goroutines handling updates when
+// UPDATE_WORKERS is not set.
+const defaultUpdateWorkers = 8
+
+// updateQueueSize is how many updates may wait for one worker.
+const updateQueueSize = 64
+
+// updatePool handles updates concurrently on a fixed set of workers. All
+// updates from one chat land on the same worker, so a chat's updates are
+// handled one at a time and in the order Telegram sent them, while a slow
+// catalog search only holds up the chats sharing that worker.
+type updatePool struct {
+	queues []chan tgbotapi.Update
+	wg     sync.WaitGroup
+}
+
+func newUpdatePool(ctx context.Context, workers int,
+	handle func(tgbotapi.Update)) *updatePool {
+	if workers < 1 {
+		workers = 1
+	}
+
+	pool := &updatePool{queues: make([]chan tgbotapi.Update, workers)}
+
+	for i := range pool.queues {
+		queue := make(chan tgbotapi.Update, updateQueueSize)
+		pool.queues[i] = queue
+
+		pool.wg.Add(1)
+		go func() {
+			defer pool.wg.Done()
+			for update := range queue {
+				handleSafely(ctx, handle, update)
+			}
+		}()
+	}
+
+	return pool
+}
+
+// handleSafely handles update, turning a panic into an error log so one bad
+// update doesn't take down the worker and every chat on it.
+func handleSafely(ctx context.Context, handle func(tgbotapi.Update),
+	update tgbotapi.Update) {
+	defer func() {
+		if r := recover(); r != nil {
+			logs.DefaultFromCtx(ctx).Error("Panic handling update",
+				"update_id", update.UpdateID,
+				"panic", r,
+				"stack", string(debug.Stack()))
+		}
+	}()
+
+	handle(update)
+}
+
+// dispatch queues update on its chat's worker. It blocks while that worker
+// is full and gives up when ctx is done.
+func (pool *updatePool) dispatch(ctx context.Context, update tgbotapi.Update) {
+	shard := updateChatID(update) % int64(len(pool.queues))
+	if shard < 0 {
+		shard = -shard
+	}
+
+	select {
+	case pool.queues[shard] <- update:
+	case <-ctx.Done():
+	}
+}
+
+// stop lets the workers finish the queued updates and waits for them.
+func (pool *updatePool) stop() {
+	for _, queue := range pool.queues {
+		close(queue)
+	}
+	pool.wg.Wait()
+}
+
+// updateChatID is the chat an update belongs to, falling back to the
+// sender for updates without a chat.
+func updateChatID(update tgbotapi.Update) int64 {
+	switch {
+	case update.Message != nil:
+		return update.Message.Chat.ID
+	case update.CallbackQuery != nil && update.CallbackQuery.Message != nil:
+		return update.CallbackQuery.Message.Chat.ID
+	case update.CallbackQuery != nil:
+		return int64(update.CallbackQuery.From.ID)
+	case update.InlineQuery != nil:
+		return int64(update.InlineQuery.From.ID)
+	}
+	return 0
+}
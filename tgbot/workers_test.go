@@ -0,0 +1,88 @@
+package tgbot
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"smOwd/tgbot/tgfake"
+
+	"github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+func TestUpdatePoolSurvivesPanic(t *testing.T) {
+	var mu sync.Mutex
+	var handled []int
+
+	pool := newUpdatePool(context.Background(), 1, func(update tgbotapi.Update) {
+		if update.UpdateID == 1 {
+			panic("bad update")
+		}
+
+		mu.Lock()
+		handled = append(handled, update.UpdateID)
+		mu.Unlock()
+	})
+
+	for id := 1; id <= 3; id++ {
+		pool.dispatch(context.Background(), tgbotapi.Update{UpdateID: id})
+	}
+
+	pool.stop()
+
+	if len(handled) != 2 || handled[0] != 2 || handled[1] != 3 {
+		t.Errorf("handled %v, want [2 3] after the panic", handled)
+	}
+}
+
+func TestUpdateChatID(t *testing.T) {
+	chat := &tgbotapi.Chat{ID: 42}
+	from := &tgbotapi.User{ID: 7}
+
+	tests := []struct {
+		name   string
+		update tgbotapi.Update
+		want   int64
+	}{
+		{"message", tgbotapi.Update{Message: &tgbotapi.Message{Chat: chat}}, 42},
+		{"callback", tgbotapi.Update{CallbackQuery: &tgbotapi.CallbackQuery{
+			From: from, Message: &tgbotapi.Message{Chat: chat}}}, 42},
+		{"inline callback", tgbotapi.Update{CallbackQuery: &tgbotapi.CallbackQuery{
+			From: from, InlineMessageID: "x"}}, 7},
+		{"inline query", tgbotapi.Update{InlineQuery: &tgbotapi.InlineQuery{
+			From: from}}, 7},
+		{"other", tgbotapi.Update{}, 0},
+	}
+
+	for _, tt := range tests {
+		if got := updateChatID(tt.update); got != tt.want {
+			t.Errorf("%s: updateChatID = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestHandleUpdateCallbackWithoutMessage(t *testing.T) {
+	fake := tgfake.New()
+	ts := fake.Start()
+	defer ts.Close()
+
+	api, err := tgfake.NewBotAPI(ts, "token")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	update := tgbotapi.Update{CallbackQuery: &tgbotapi.CallbackQuery{
+		ID:              "1",
+		From:            &tgbotapi.User{ID: 7},
+		InlineMessageID: "x",
+		Data:            "1:sub:52991:abc",
+	}}
+
+	// No database: the update must be answered before reaching it
+	handleUpdate(context.Background(), NewMessenger(api), update, nil, nil,
+		nil, nil)
+
+	if calls := fake.CallsTo("answerCallbackQuery"); len(calls) != 1 {
+		t.Errorf("%d answerCallbackQuery calls, want 1", len(calls))
+	}
+}
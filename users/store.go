@@ -0,0 +1,119 @@
+package users
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+)
+
+// UserStore is what the bot needs of the users table, so conversations can
+// run against memory in tests.
+type UserStore interface {
+	Add(ctx context.Context, u *User) (int, error)
+	FindByTelegramID(ctx context.Context, telegramID int) *User
+	FindByChatID(ctx context.Context, chatID int) *User
+	Enable(ctx context.Context, id int) error
+	Disable(ctx context.Context, id int) error
+}
+
+// PostgresStore is a UserStore backed by the users table.
+type PostgresStore struct {
+	db *sql.DB
+}
+
+func NewPostgresStore(db *sql.DB) *PostgresStore {
+	return &PostgresStore{db: db}
+}
+
+func (p *PostgresStore) Add(ctx context.Context, u *User) (int, error) {
+	return Add(ctx, p.db, u)
+}
+
+func (p *PostgresStore) FindByTelegramID(ctx context.Context, telegramID int) *User {
+	return FindByTelegramID(ctx, p.db, telegramID)
+}
+
+func (p *PostgresStore) FindByChatID(ctx context.Context, chatID int) *User {
+	return FindByChatID(ctx, p.db, chatID)
+}
+
+func (p *PostgresStore) Enable(ctx context.Context, id int) error {
+	return Enable(ctx, p.db, id)
+}
+
+func (p *PostgresStore) Disable(ctx context.Context, id int) error {
+	return Disable(ctx, p.db, id)
+}
+
+// MemoryStore is a UserStore kept in process memory, for tests and for
+// running without a database.
+type MemoryStore struct {
+	mu     sync.Mutex
+	users  []User
+	nextID int
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{nextID: 1}
+}
+
+// Add returns -1 without error for a user already there, like the table's
+// ON CONFLICT DO NOTHING.
+func (m *MemoryStore) Add(ctx context.Context, u *User) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, existing := range m.users {
+		if existing.TelegramID == u.TelegramID {
+			return -1, nil
+		}
+	}
+
+	user := *u
+	user.ID = m.nextID
+	m.nextID++
+
+	m.users = append(m.users, user)
+
+	return user.ID, nil
+}
+
+func (m *MemoryStore) find(match func(User) bool) *User {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, u := range m.users {
+		if match(u) {
+			return &u
+		}
+	}
+	return nil
+}
+
+func (m *MemoryStore) FindByTelegramID(ctx context.Context, telegramID int) *User {
+	return m.find(func(u User) bool { return u.TelegramID == telegramID })
+}
+
+func (m *MemoryStore) FindByChatID(ctx context.Context, chatID int) *User {
+	return m.find(func(u User) bool { return u.ChatID == chatID })
+}
+
+func (m *MemoryStore) setEnabled(id int, val bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := range m.users {
+		if m.users[i].ID == id {
+			m.users[i].Enabled = val
+		}
+	}
+	return nil
+}
+
+func (m *MemoryStore) Enable(ctx context.Context, id int) error {
+	return m.setEnabled(id, true)
+}
+
+func (m *MemoryStore) Disable(ctx context.Context, id int) error {
+	return m.setEnabled(id, false)
+}